@@ -0,0 +1,23 @@
+package readcache
+
+// GetResult is the outcome of a GetAsync call.
+type GetResult struct {
+	Value interface{}
+	Err   error
+}
+
+func (c *readcache) GetAsync(key string) <-chan GetResult {
+	cfg := settings(c)
+	results := make(chan GetResult, 1)
+	go func() {
+		var result GetResult
+		cachedValue, err := get(c, cfg, key)
+		if cachedValue != nil {
+			result.Value = cachedValue.Value
+		}
+		result.Err = err
+		results <- result
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,43 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetAsync_SeveralKeys_ShouldDeliverEachResult(t *testing.T) {
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount.Add(1)
+		if key == "broken" {
+			return nil, time.Time{}, errors.New("Error message")
+		}
+		return "value of " + key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	pending := make(map[string]<-chan GetResult)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("key%d", i)
+		pending[key] = cache.GetAsync(key)
+	}
+	broken := cache.GetAsync("broken")
+	for key, results := range pending {
+		result := <-results
+		if result.Value != "value of "+key || result.Err != nil {
+			t.Errorf("Expected 'value of %s' but got %v, %v", key, result.Value, result.Err)
+		}
+		if _, open := <-results; open {
+			t.Errorf("Expected the channel of %s to be closed after its result", key)
+		}
+	}
+	if result := <-broken; result.Value != nil || result.Err == nil {
+		t.Errorf("Expected an error but got %v, %v", result.Value, result.Err)
+	}
+	if fetchCount.Load() != 6 {
+		t.Errorf("Expected 6 fetches but got %d", fetchCount.Load())
+	}
+}
@@ -0,0 +1,96 @@
+package readcache
+
+import (
+	"container/list"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// The default number of keys for which a fetch error is remembered.
+const defaultErrorBackoffSize = 1024
+
+// Type errorBackoff remembers recent fetch errors so that requests for a
+// failing key can be rejected without fetching again.  It holds a bounded
+// number of keys, forgetting the least recently failed key when full.
+type errorBackoff struct {
+	// Locks the backoff entries for reads or writes
+	Lock *sync.Mutex
+
+	// The backoff entries, by key
+	Entries map[string]*list.Element
+
+	// The backoff entries, most recently failed first
+	Order *list.List
+
+	// The maximum number of entries, unless configured otherwise
+	MaxEntries int
+}
+
+// Type backoffEntry is a remembered fetch error
+type backoffEntry struct {
+	Key   string
+	Error error
+	Until time.Time
+}
+
+// Choose how long to remember a fetch error, applying the configured jitter.
+// Jitter outside of zero to one is clamped.
+func backoffDuration(cfg *Config) time.Duration {
+	jitter := min(max(cfg.ErrorBackoffJitter, 0), 1)
+	if jitter == 0 {
+		return cfg.ErrorBackoff
+	}
+	return cfg.ErrorBackoff - time.Duration(rand.Float64()*jitter*float64(cfg.ErrorBackoff))
+}
+
+func newErrorBackoff(maxEntries int) *errorBackoff {
+	return &errorBackoff{new(sync.Mutex), make(map[string]*list.Element), list.New(), maxEntries}
+}
+
+// Get the remembered error for a key, if it has not expired.
+func (b *errorBackoff) get(key string, now time.Time) (error, bool) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	element, ok := b.Entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*backoffEntry)
+	if !entry.Until.After(now) {
+		b.Order.Remove(element)
+		delete(b.Entries, key)
+		return nil, false
+	}
+	return entry.Error, true
+}
+
+// Remember an error for a key until the given time, forgetting the least
+// recently failed keys if there are more than the given maximum, or than
+// MaxEntries if it is not positive.
+func (b *errorBackoff) add(key string, err error, until time.Time, maxEntries int) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	if element, ok := b.Entries[key]; ok {
+		b.Order.Remove(element)
+	}
+	b.Entries[key] = b.Order.PushFront(&backoffEntry{key, err, until})
+
+	if maxEntries <= 0 {
+		maxEntries = b.MaxEntries
+	}
+	for len(b.Entries) > maxEntries {
+		oldest := b.Order.Back()
+		b.Order.Remove(oldest)
+		delete(b.Entries, oldest.Value.(*backoffEntry).Key)
+	}
+}
+
+// Report the number of remembered errors, including expired ones.
+func (b *errorBackoff) len() int {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return len(b.Entries)
+}
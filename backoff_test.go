@@ -0,0 +1,175 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGet_WithErrorBackoff_RepeatedErrors_ShouldThrottleGetter(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetErrorBackoff(100e9)
+	for i := 0; i < 10; i++ {
+		_, err := cache.Get("key")
+		if err == nil || err.Error() != "Error message" {
+			t.Errorf("Expected 'Error message' but got %v", err)
+		}
+	}
+	if fetchCount != 1 {
+		t.Errorf("Should have only fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithErrorBackoff_AfterBackoffExpires_ShouldFetchAgain(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetErrorBackoff(10 * time.Millisecond)
+	cache.Get("key")
+	time.Sleep(20 * time.Millisecond)
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Should have fetched twice, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithErrorBackoff_ErrorWithExpiry_ShouldRememberErrorUntilExpiry(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		expiry      time.Duration
+		refetchedAt time.Duration
+	}{
+		{"zero expiry", 0, time.Hour},
+		{"future expiry", time.Minute, time.Minute},
+	} {
+		clock := NewTestClock(time.Now())
+		fetchCount := 0
+		getter := func(key string) (interface{}, time.Time, error) {
+			fetchCount++
+			if test.expiry == 0 {
+				return nil, time.Time{}, errors.New("Error message")
+			}
+			return nil, clock.Now().Add(test.expiry), errors.New("Error message")
+		}
+		cache := New(getter)
+		cache.SetClock(clock)
+		cache.SetErrorBackoff(time.Hour)
+		cache.Get("key")
+
+		clock.Advance(test.refetchedAt - time.Second)
+		cache.Get("key")
+		if fetchCount != 1 {
+			t.Errorf("%s: Expected the error to be remembered, but got %d fetches", test.name, fetchCount)
+		}
+		clock.Advance(time.Second)
+		cache.Get("key")
+		if fetchCount != 2 {
+			t.Errorf("%s: Expected a fetch once the error expired, but got %d fetches", test.name, fetchCount)
+		}
+	}
+}
+
+func TestGet_WithoutErrorBackoff_RepeatedErrors_ShouldFetchEachTime(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.Get("key")
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Should have fetched twice, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithErrorBackoff_ManyFailingKeys_ShouldStayBounded(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetErrorBackoff(100e9)
+	backoffs := cache.(*readcache).ErrorBackoffs
+	backoffs.MaxEntries = 16
+
+	for i := 0; i < 100; i++ {
+		cache.Get(fmt.Sprintf("%d", i))
+	}
+	if size := backoffs.len(); size != 16 {
+		t.Errorf("Expected 16 remembered errors but got %d", size)
+	}
+	if _, ok := backoffs.get("99", time.Now()); !ok {
+		t.Error("The most recent failure should still be remembered")
+	}
+	if _, ok := backoffs.get("0", time.Now()); ok {
+		t.Error("The oldest failure should have been forgotten")
+	}
+}
+
+func TestGet_WithMaxNegativeEntries_FloodOfMissingKeys_ShouldKeepCachedItems(t *testing.T) {
+	notFound := errors.New("Not found")
+	getter := func(key string) (interface{}, time.Time, error) {
+		if strings.HasPrefix(key, "missing") {
+			return nil, time.Now(), notFound
+		}
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetErrorBackoff(100e9)
+	cache.SetMaxNegativeEntries(10)
+	cache.SetPurgeAt(20)
+	cache.SetPurgeTo(15)
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("found%d", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		cache.Get(fmt.Sprintf("missing%d", i))
+	}
+	if size := cache.(*readcache).ErrorBackoffs.len(); size != 10 {
+		t.Errorf("Expected 10 remembered errors but got %d", size)
+	}
+	for i := 0; i < 10; i++ {
+		if status := cache.Status(fmt.Sprintf("found%d", i)); status != StatusFresh {
+			t.Errorf("Expected found%d to survive but got %v", i, status)
+		}
+	}
+}
+
+func TestGet_WithErrorBackoffJitter_SimultaneousErrors_ShouldSpreadBackoffs(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, clock.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetErrorBackoff(100e9)
+	cache.SetErrorBackoffJitter(0.5)
+	for i := 0; i < 20; i++ {
+		cache.Get(fmt.Sprintf("%d", i))
+	}
+
+	backoffs := cache.(*readcache).ErrorBackoffs
+	untils := make(map[time.Time]bool)
+	for element := backoffs.Order.Front(); element != nil; element = element.Next() {
+		until := element.Value.(*backoffEntry).Until
+		backoff := until.Sub(clock.Now())
+		if backoff < 50e9 || backoff > 100e9 {
+			t.Errorf("Expected a backoff between 50s and 100s but got %s", backoff)
+		}
+		untils[until] = true
+	}
+	if len(untils) < 2 {
+		t.Errorf("Expected the backoffs to be spread out, but all %d expire together", backoffs.len())
+	}
+}
@@ -0,0 +1,60 @@
+package readcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBackendUnavailable is returned by Get for an item which is not cached
+// while the circuit breaker is open; see SetCircuitBreaker.
+var ErrBackendUnavailable = errors.New("readcache: backend is unavailable")
+
+// ErrCircuitOpen is another name for ErrBackendUnavailable.
+var ErrCircuitOpen = ErrBackendUnavailable
+
+// Type circuitBreaker tracks consecutive failures of the item fetcher, so that
+// fetches can fail fast while it is known to be down.
+type circuitBreaker struct {
+	// Locks the breaker for reads or writes
+	Lock *sync.Mutex
+
+	// The number of consecutive failed fetches
+	Failures int
+
+	// The time until which the breaker is open
+	OpenUntil time.Time
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{Lock: new(sync.Mutex)}
+}
+
+// Determine whether fetches should fail fast at the given time.
+func (b *circuitBreaker) isOpen(cfg *Config, now time.Time) bool {
+	if cfg.BreakerFailures <= 0 {
+		return false
+	}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return now.Before(b.OpenUntil)
+}
+
+// Record the outcome of a fetch, opening the breaker if it completes the
+// configured number of consecutive failures.  Once that many have failed,
+// each further failure opens the breaker again.
+func (b *circuitBreaker) record(cfg *Config, now time.Time, err error) {
+	if cfg.BreakerFailures <= 0 {
+		return
+	}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	if err == nil {
+		b.Failures = 0
+		return
+	}
+	b.Failures++
+	if b.Failures >= cfg.BreakerFailures {
+		b.OpenUntil = now.Add(cfg.BreakerCooldown)
+	}
+}
@@ -0,0 +1,113 @@
+package readcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGet_WithCircuitBreaker_Open_ShouldServeHitsAndFailMissesFast(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	down := false
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		if down {
+			return nil, time.Time{}, errors.New("backend down")
+		}
+		return "foo", clock.Now().Add(time.Hour), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetCircuitBreaker(2, time.Minute)
+	cache.Get("cached")
+
+	down = true
+	cache.Get("first")
+	cache.Get("second")
+	if fetchCount != 3 {
+		t.Fatalf("Expected 3 fetches before the breaker opened but got %d", fetchCount)
+	}
+	if result, err := cache.Get("cached"); result != "foo" || err != nil {
+		t.Errorf("Expected the cached 'foo' but got %v, %v", result, err)
+	}
+	if _, err := cache.Get("uncached"); err != ErrBackendUnavailable {
+		t.Errorf("Expected ErrBackendUnavailable but got %v", err)
+	}
+	if fetchCount != 3 {
+		t.Errorf("Expected no fetch while the breaker is open but got %d fetches", fetchCount)
+	}
+
+	down = false
+	clock.Advance(time.Minute)
+	if result, err := cache.Get("uncached"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' after the cooldown but got %v, %v", result, err)
+	}
+}
+
+func TestGet_WithCircuitBreaker_FailureAfterCooldown_ShouldReopen(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Time{}, errors.New("backend down")
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetCircuitBreaker(1, time.Minute)
+	cache.Get("key")
+
+	clock.Advance(time.Minute)
+	if _, err := cache.Get("key"); err == nil || err == ErrBackendUnavailable {
+		t.Errorf("Expected the fetcher's error after the cooldown but got %v", err)
+	}
+	if _, err := cache.Get("key"); err != ErrBackendUnavailable {
+		t.Errorf("Expected ErrBackendUnavailable once reopened but got %v", err)
+	}
+	if fetchCount != 2 {
+		t.Errorf("Expected 2 fetches but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithCircuitOpenFallback_Open_ShouldServeFallbackValue(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Time{}, errors.New("backend down")
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetCircuitBreaker(1, time.Minute)
+	cache.SetCircuitOpenFallback(func(key string) (interface{}, bool) {
+		return "local " + key, key != "unknown"
+	})
+	cache.Get("first")
+
+	if result, source, err := cache.GetSourced("uncached"); result != "local uncached" || source != SourceFallback || err != nil {
+		t.Errorf("Expected the fallback's 'local uncached' but got %v, %s, %v", result, source, err)
+	}
+	if status := cache.Status("uncached"); status != StatusAbsent {
+		t.Errorf("Expected the fallback value not to be cached but got %s", status)
+	}
+	if _, err := cache.Get("unknown"); err != ErrBackendUnavailable {
+		t.Errorf("Expected ErrBackendUnavailable without a fallback value but got %v", err)
+	}
+	if fetchCount != 1 {
+		t.Errorf("Expected no fetch while the breaker is open but got %d fetches", fetchCount)
+	}
+}
+
+func TestGet_WithCircuitBreaker_NotFound_ShouldNotOpen(t *testing.T) {
+	cache := New(newNotFoundGetter())
+	cache.SetCircuitBreaker(3, time.Minute)
+	for i := 0; i < 3; i++ {
+		cache.Delete("missing")
+		if _, err := cache.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound but got %v", err)
+		}
+	}
+	if result, err := cache.Get("real"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' with the breaker closed but got %v, %v", result, err)
+	}
+}
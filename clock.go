@@ -0,0 +1,144 @@
+package readcache
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time.  The cache uses its clock to decide when items have
+// expired, so a controllable clock, such as TestClock, may be used to test
+// expiry.  Durations of fetches are always measured in real time.  A clock may
+// also have a Since(time.Time) time.Duration method; see SetMonotonicExpiry.
+// It may also have a NewTicker(time.Duration) (<-chan time.Time, func())
+// method, returning the channel of a ticker and the function which stops it,
+// for periodic work such as SetStatsReporter; a clock without one ticks in
+// real time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Type realClock is the Clock which tells the real time
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Measure the time elapsed since a time told by Now, using the monotonic clock.
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// Start a ticker on a clock, which ticks in real time if the clock has no
+// tickers of its own.  The interval must be positive.
+func newTicker(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if ticking, ok := clock.(interface {
+		NewTicker(time.Duration) (<-chan time.Time, func())
+	}); ok {
+		return ticking.NewTicker(d)
+	}
+	return realClock{}.NewTicker(d)
+}
+
+// TestClock is a Clock which only moves when told to, for tests of code which
+// depends on items expiring.  It is safe for concurrent use.
+type TestClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	tickers map[*testTicker]bool
+}
+
+// Type testTicker is a ticker started by TestClock.NewTicker.
+type testTicker struct {
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+}
+
+// NewTestClock constructs a TestClock which tells the given time until it is
+// moved.
+func NewTestClock(t0 time.Time) *TestClock {
+	return &TestClock{now: t0}
+}
+
+func (c *TestClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Move the clock forward by the given duration.
+func (c *TestClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	c.tick()
+	c.lock.Unlock()
+}
+
+// Move the clock to the given time, which may be earlier than the time it
+// tells.
+func (c *TestClock) Set(t time.Time) {
+	c.lock.Lock()
+	c.now = t
+	c.tick()
+	c.lock.Unlock()
+}
+
+// Start a ticker which ticks whenever the clock is moved past the end of
+// another interval.  However far the clock is moved, each ticker ticks at
+// most once, and like a time.Ticker, a ticker drops ticks for a slow
+// receiver.  Returns the ticker's channel and the function which stops it.
+func (c *TestClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ticker := &testTicker{d, c.now.Add(d), make(chan time.Time, 1)}
+	if c.tickers == nil {
+		c.tickers = make(map[*testTicker]bool)
+	}
+	c.tickers[ticker] = true
+	return ticker.c, func() {
+		c.lock.Lock()
+		delete(c.tickers, ticker)
+		c.lock.Unlock()
+	}
+}
+
+// Tick the tickers whose intervals have ended.  The caller must hold the
+// lock.
+func (c *TestClock) tick() {
+	for ticker := range c.tickers {
+		if ticker.next.After(c.now) {
+			continue
+		}
+		select {
+		case ticker.c <- c.now:
+		default:
+		}
+		ticker.next = ticker.next.Add(ticker.interval * (c.now.Sub(ticker.next)/ticker.interval + 1))
+	}
+}
+
+// Determine when an item expires.  If the item was stored under monotonic
+// expiry, this is wherever its time to live runs out, as measured from when
+// it was stored by the clock's Since method, or by Now if it has none.  An
+// item stored before the current generation has expired at the zero time.
+func expiryTime(c *readcache, cfg *Config, item *cacheable, now time.Time) time.Time {
+	if item.Generation != c.Generation.Load() {
+		return time.Time{}
+	}
+	if !cfg.MonotonicExpiry || item.FetchedAt.IsZero() {
+		return item.ExpiresAt
+	}
+	var elapsed time.Duration
+	if clock, ok := cfg.Clock.(interface{ Since(time.Time) time.Duration }); ok {
+		elapsed = clock.Since(item.FetchedAt)
+	} else {
+		elapsed = now.Sub(item.FetchedAt)
+	}
+	return now.Add(item.TTL - elapsed)
+}
@@ -0,0 +1,96 @@
+package readcache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTestClock_AdvanceAndSet_ShouldMoveTime(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewTestClock(t0)
+	if now := clock.Now(); !now.Equal(t0) {
+		t.Errorf("Expected %v but got %v", t0, now)
+	}
+
+	clock.Advance(time.Minute)
+	if now := clock.Now(); !now.Equal(t0.Add(time.Minute)) {
+		t.Errorf("Expected the clock to advance by a minute but got %v", now)
+	}
+
+	clock.Set(t0.Add(-time.Hour))
+	if now := clock.Now(); !now.Equal(t0.Add(-time.Hour)) {
+		t.Errorf("Expected the clock to be set back an hour but got %v", now)
+	}
+}
+
+func TestTestClock_ConcurrentAdvance_ShouldCountEveryAdvance(t *testing.T) {
+	t0 := time.Now()
+	clock := NewTestClock(t0)
+	var wait sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			clock.Advance(time.Second)
+			clock.Now()
+		}()
+	}
+	wait.Wait()
+
+	if elapsed := clock.Now().Sub(t0); elapsed != 100*time.Second {
+		t.Errorf("Expected 100s to have elapsed but got %v", elapsed)
+	}
+}
+
+func ExampleTestClock() {
+	clock := NewTestClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewLazy()
+	cache.SetClock(clock)
+	cache.Set("greeting", "hello", clock.Now().Add(time.Minute))
+
+	fmt.Println(cache.Status("greeting") == StatusFresh)
+	clock.Advance(time.Minute)
+	fmt.Println(cache.Status("greeting") == StatusFresh)
+	// Output:
+	// true
+	// false
+}
+
+func TestTestClock_NewTicker_ShouldTickAtEachInterval(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewTestClock(t0)
+	ticks, stop := clock.NewTicker(time.Minute)
+	ticked := func() bool {
+		select {
+		case <-ticks:
+			return true
+		default:
+			return false
+		}
+	}
+
+	clock.Advance(30 * time.Second)
+	if ticked() {
+		t.Errorf("Expected no tick within an interval")
+	}
+	clock.Advance(30 * time.Second)
+	if !ticked() {
+		t.Errorf("Expected a tick at the end of an interval")
+	}
+	clock.Advance(150 * time.Second)
+	if !ticked() || ticked() {
+		t.Errorf("Expected a single tick after several intervals")
+	}
+	clock.Advance(30 * time.Second)
+	if !ticked() {
+		t.Errorf("Expected a tick at the end of the following interval")
+	}
+
+	stop()
+	clock.Advance(time.Hour)
+	if ticked() {
+		t.Errorf("Expected no tick after stopping")
+	}
+}
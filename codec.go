@@ -0,0 +1,76 @@
+package readcache
+
+import (
+	"time"
+)
+
+// Codec serializes the values held by a cache; see SetValueCodec.
+type Codec interface {
+	// Serialize a value to be held in the cache.
+	Encode(value interface{}) ([]byte, error)
+
+	// Restore a value from its serialized form.
+	Decode(data []byte) (interface{}, error)
+}
+
+// NewCompact constructs a new cache which holds its items serialized with the
+// given codec, rather than as the values themselves, trading the cost of
+// decoding each hit for a smaller footprint.  It is equivalent to New
+// followed by SetValueCodec.
+func NewCompact(getter func(string) (interface{}, time.Time, error), codec Codec) CacheWithSettings {
+	c := newReadcache(getter)
+	c.Settings.ValueCodec = codec
+	return c
+}
+
+// Serialize the value of an item to be stored in the cache, if a value codec
+// is configured, unless its serialized form is within the compression
+// threshold.  Items are never modified once cached, so an encoded copy is
+// returned, leaving the given item to be handed to the caller.
+func encodeItem(cfg *Config, item *cacheable) (*cacheable, error) {
+	if cfg.ValueCodec == nil {
+		return item, nil
+	}
+	data, err := cfg.ValueCodec.Encode(item.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= cfg.CompressionThreshold {
+		return item, nil
+	}
+	encoded := *item
+	encoded.Value = data
+	encoded.Codec = cfg.ValueCodec
+	return &encoded, nil
+}
+
+// Restore the value of an item found in the cache, if it was stored encoded
+// or is held weakly.
+// The cached item is left as it was, so that a value which fails to decode
+// does not disturb it.
+func decodeItem(item *cacheable) (*cacheable, error) {
+	if item == nil {
+		return item, nil
+	}
+	if item = strengthenItem(item); item.Codec == nil {
+		return item, nil
+	}
+	value, err := item.Codec.Decode(item.Value.([]byte))
+	if err != nil {
+		return nil, err
+	}
+	decoded := *item
+	decoded.Value = value
+	decoded.Codec = nil
+	return &decoded, nil
+}
+
+// Restore the value of an item found in the cache, for uses which cannot
+// report an error.  A value which fails to decode is given as nil.
+func decodedValue(item *cacheable) interface{} {
+	decoded, err := decodeItem(item)
+	if err != nil {
+		return nil
+	}
+	return decoded.Value
+}
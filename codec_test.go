@@ -0,0 +1,103 @@
+package readcache
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Type intCodec serializes ints as their decimal representation.
+type intCodec struct{}
+
+func (intCodec) Encode(value interface{}) ([]byte, error) {
+	n, ok := value.(int)
+	if !ok {
+		return nil, errors.New("not an int")
+	}
+	return []byte(strconv.Itoa(n)), nil
+}
+
+func (intCodec) Decode(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestNewCompact_Get_ShouldRoundTripValuesStoredAsBytes(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return 1234, time.Now().Add(100e9), nil
+	}
+	cache := NewCompact(getter, intCodec{})
+
+	for i := 0; i < 2; i++ {
+		value, err := cache.Get("a")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if value != 1234 {
+			t.Errorf("Expected 1234 but got %v", value)
+		}
+	}
+
+	stored := cache.(*readcache).Cache["a"]
+	if data, ok := stored.Value.([]byte); !ok || string(data) != "1234" {
+		t.Errorf("Expected the item to be stored as bytes but got %#v", stored.Value)
+	}
+	if stats := cache.Stats(); stats.EncodedEntries != 1 || stats.EncodedBytes != 4 {
+		t.Errorf("Expected 1 encoded entry of 4 bytes but got %d of %d", stats.EncodedEntries, stats.EncodedBytes)
+	}
+}
+
+func TestSetCompressionThreshold_ShouldEncodeOnlyLargeValues(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "large" {
+			return 1234567890, time.Now().Add(100e9), nil
+		}
+		return 7, time.Now().Add(100e9), nil
+	}
+	cache := NewCompact(getter, intCodec{})
+	cache.SetCompressionThreshold(4)
+	cache.Get("small")
+	cache.Get("large")
+
+	stored := cache.(*readcache).Cache
+	if stored["small"].Codec != nil || stored["small"].Value != 7 {
+		t.Errorf("Expected the small value to be stored as it is but got %#v", stored["small"].Value)
+	}
+	if stored["large"].Codec == nil {
+		t.Errorf("Expected the large value to be stored encoded but got %#v", stored["large"].Value)
+	}
+	if result, _ := cache.Get("small"); result != 7 {
+		t.Errorf("Expected 7 but got %v", result)
+	}
+	if result, _ := cache.Get("large"); result != 1234567890 {
+		t.Errorf("Expected 1234567890 but got %v", result)
+	}
+	if stats := cache.Stats(); stats.EncodedEntries != 1 || stats.EncodedBytes != 10 {
+		t.Errorf("Expected 1 encoded entry of 10 bytes but got %d of %d", stats.EncodedEntries, stats.EncodedBytes)
+	}
+}
+
+func TestSetValueCodec_UndecodableItem_ShouldReturnErrorAndKeepItem(t *testing.T) {
+	cache := NewLazy()
+	cache.SetValueCodec(intCodec{})
+	cache.Set("a", 1, time.Now().Add(100e9))
+	cache.(*readcache).Cache["a"].Value = []byte("garbage")
+
+	if _, err := cache.Get("a"); err == nil {
+		t.Errorf("Expected a decoding error")
+	}
+	if status := cache.Status("a"); status != StatusFresh {
+		t.Errorf("Expected the item to remain cached but got %v", status)
+	}
+}
+
+func TestSetValueCodec_UnencodableItem_ShouldNotCache(t *testing.T) {
+	cache := NewLazy()
+	cache.SetValueCodec(intCodec{})
+	cache.Set("a", 1, time.Now().Add(100e9))
+	cache.Set("a", "not an int", time.Now().Add(100e9))
+
+	if status := cache.Status("a"); status != StatusAbsent {
+		t.Errorf("Expected the item not to be cached but got %v", status)
+	}
+}
@@ -0,0 +1,400 @@
+package readcache
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Config bundles the tunable settings of a cache, so that they can be
+// replaced together by Reconfigure.  Each setting is described by its setter
+// on CacheWithSettings.
+type Config struct {
+	Getter               func(string) (interface{}, time.Time, error)
+	ContextGetter        func(ctx context.Context, key string) (interface{}, time.Time, error)
+	FanOutGetter         func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error)
+	FallbackGetter       func(string) (interface{}, time.Time, error)
+	HedgeDelay           time.Duration
+	PurgeAt              int
+	PurgeTo              int
+	Logger               *slog.Logger
+	CostBasedTTL         func(fetchDuration time.Duration) time.Duration
+	TTLOverride          func(key string, value interface{}, getterExpiry time.Time) time.Time
+	MinResultReuse       time.Duration
+	OnEvict              func(key string, value interface{}, reason EvictionReason)
+	CacheNilValues       bool
+	CachePredicate       func(key string, value interface{}) bool
+	Observers            []Observer
+	EventBuffer          int
+	ErrorBackoff         time.Duration
+	ErrorBackoffJitter   float64
+	MaxNegativeEntries   int
+	BreakerFailures      int
+	BreakerCooldown      time.Duration
+	CircuitOpenFallback  func(key string) (interface{}, bool)
+	L2                   L2
+	SpillStore           L2
+	Clock                Clock
+	SlidingExpiration    time.Duration
+	OnHitExpiry          func(key string, value interface{}, currentExpiry time.Time) time.Time
+	HistoryDepth         int
+	MaxKeyLength         int
+	MaxConcurrentFetches int
+	StaleWhileRevalidate time.Duration
+	RefetchSampling      int
+	OnRefresh            func(key string, newValue interface{}, err error)
+	PublishInvalidation  func(key string)
+	MaxInFlightFetches   int
+	BlockExcessFetches   bool
+	MaxCoalescedWaiters  int
+	ConflictResolver     func(key string, existing, incoming SnapshotEntry) SnapshotEntry
+	TrackKeyAccess       bool
+	MonotonicExpiry      bool
+	PastExpiryPolicy     PastExpiryPolicy
+	PastExpiryMinimumTTL time.Duration
+	PrefixTTLs           map[string]time.Duration
+	ETagFunc             func(value interface{}) string
+	NodeID               string
+	PriorityTiers        map[string]int
+	EvictionPolicy       Policy
+	EvictionChunkSize    int
+	WriteBehindBuffer    int
+	BlockWriteBehind     bool
+	EvictWorkers         int
+	EvictQueueSize       int
+	BlockEvictCallbacks  bool
+	ValueCodec           Codec
+	CompressionThreshold int
+	Sizer                func(value interface{}) int64
+	MaxEntryBytes        int64
+	Validator            func(key string, value interface{}) bool
+	WeakValues           bool
+	InterningHash        func(value interface{}) string
+	Interning            func(a, b interface{}) bool
+	SuppressRedundantSet func(a, b interface{}) bool
+}
+
+func (c *readcache) Config() Config {
+	cfg := *settings(c)
+	cfg.Observers = append([]Observer(nil), cfg.Observers...)
+	cfg.PrefixTTLs = maps.Clone(cfg.PrefixTTLs)
+	cfg.PriorityTiers = maps.Clone(cfg.PriorityTiers)
+	return cfg
+}
+
+func (c *readcache) Reconfigure(cfg Config) {
+	cfg.Observers = append([]Observer(nil), cfg.Observers...)
+	cfg.PrefixTTLs = maps.Clone(cfg.PrefixTTLs)
+	cfg.PriorityTiers = maps.Clone(cfg.PriorityTiers)
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	c.SettingsLock.Lock()
+	c.Settings = &cfg
+	c.SettingsLock.Unlock()
+	migratePolicy(c)
+}
+
+func (c *readcache) SetPurgeAt(purgeAt int) {
+	configure(c, func(cfg *Config) { cfg.PurgeAt = purgeAt })
+}
+
+func (c *readcache) SetPurgeTo(purgeTo int) {
+	configure(c, func(cfg *Config) { cfg.PurgeTo = purgeTo })
+}
+
+func (c *readcache) SetEvictionChunkSize(n int) {
+	configure(c, func(cfg *Config) { cfg.EvictionChunkSize = n })
+}
+
+func (c *readcache) SetGetter(getter func(string) (interface{}, time.Time, error)) {
+	configure(c, func(cfg *Config) {
+		cfg.Getter = getter
+		cfg.ContextGetter = nil
+		cfg.FanOutGetter = nil
+	})
+}
+
+func (c *readcache) SetContextGetter(getter func(ctx context.Context, key string) (interface{}, time.Time, error)) {
+	configure(c, func(cfg *Config) {
+		cfg.Getter = nil
+		cfg.ContextGetter = getter
+		cfg.FanOutGetter = nil
+	})
+}
+
+func (c *readcache) SetLogger(logger *slog.Logger) {
+	configure(c, func(cfg *Config) { cfg.Logger = logger })
+}
+
+func (c *readcache) SetCostBasedTTL(ttl func(fetchDuration time.Duration) time.Duration) {
+	configure(c, func(cfg *Config) { cfg.CostBasedTTL = ttl })
+}
+
+func (c *readcache) SetTTLOverride(override func(key string, value interface{}, getterExpiry time.Time) time.Time) {
+	configure(c, func(cfg *Config) { cfg.TTLOverride = override })
+}
+
+func (c *readcache) SetMinResultReuse(d time.Duration) {
+	configure(c, func(cfg *Config) { cfg.MinResultReuse = d })
+}
+
+func (c *readcache) SetOnEvict(onEvict func(key string, value interface{}, reason EvictionReason)) {
+	configure(c, func(cfg *Config) { cfg.OnEvict = onEvict })
+}
+
+func (c *readcache) SetCachePredicate(predicate func(key string, value interface{}) bool) {
+	configure(c, func(cfg *Config) { cfg.CachePredicate = predicate })
+}
+
+func (c *readcache) SetCacheNilValues(cacheNilValues bool) {
+	configure(c, func(cfg *Config) { cfg.CacheNilValues = cacheNilValues })
+}
+
+func (c *readcache) AddObserver(observer Observer) {
+	buffered := c.Events.events()
+	configure(c, func(cfg *Config) {
+		observers := make([]Observer, len(cfg.Observers), len(cfg.Observers)+1)
+		copy(observers, cfg.Observers)
+		cfg.Observers = append(observers, observer)
+	})
+	for _, event := range buffered {
+		event.replay(observer)
+	}
+}
+
+func (c *readcache) SetEventBuffer(n int) {
+	configure(c, func(cfg *Config) { cfg.EventBuffer = n })
+	c.Events.trim(n)
+}
+
+func (c *readcache) SetErrorBackoff(backoff time.Duration) {
+	configure(c, func(cfg *Config) { cfg.ErrorBackoff = backoff })
+}
+
+func (c *readcache) SetL2(l2 L2) {
+	configure(c, func(cfg *Config) { cfg.L2 = l2 })
+}
+
+func (c *readcache) SetSpillStore(store L2) {
+	configure(c, func(cfg *Config) { cfg.SpillStore = store })
+}
+
+func (c *readcache) SetFallbackGetter(getter func(string) (interface{}, time.Time, error)) {
+	configure(c, func(cfg *Config) { cfg.FallbackGetter = getter })
+}
+
+func (c *readcache) SetHedging(delay time.Duration) {
+	configure(c, func(cfg *Config) { cfg.HedgeDelay = delay })
+}
+
+func (c *readcache) SetClock(clock Clock) {
+	configure(c, func(cfg *Config) { cfg.Clock = clock })
+}
+
+func (c *readcache) SetSlidingExpiration(ttl time.Duration) {
+	configure(c, func(cfg *Config) { cfg.SlidingExpiration = ttl })
+}
+
+func (c *readcache) SetOnHitExpiry(onHit func(key string, value interface{}, currentExpiry time.Time) time.Time) {
+	configure(c, func(cfg *Config) { cfg.OnHitExpiry = onHit })
+}
+
+func (c *readcache) SetHistoryDepth(k int) {
+	configure(c, func(cfg *Config) { cfg.HistoryDepth = k })
+}
+
+func (c *readcache) SetMaxKeyLength(maxKeyLength int) {
+	configure(c, func(cfg *Config) { cfg.MaxKeyLength = maxKeyLength })
+}
+
+func (c *readcache) SetMaxConcurrentFetches(maxConcurrentFetches int) {
+	configure(c, func(cfg *Config) { cfg.MaxConcurrentFetches = maxConcurrentFetches })
+}
+
+func (c *readcache) SetMaxNegativeEntries(n int) {
+	configure(c, func(cfg *Config) { cfg.MaxNegativeEntries = n })
+}
+
+func (c *readcache) SetCircuitBreaker(failures int, cooldown time.Duration) {
+	configure(c, func(cfg *Config) {
+		cfg.BreakerFailures = failures
+		cfg.BreakerCooldown = cooldown
+	})
+}
+
+func (c *readcache) SetCircuitOpenFallback(fallback func(key string) (interface{}, bool)) {
+	configure(c, func(cfg *Config) { cfg.CircuitOpenFallback = fallback })
+}
+
+func (c *readcache) SetErrorBackoffJitter(jitter float64) {
+	configure(c, func(cfg *Config) { cfg.ErrorBackoffJitter = jitter })
+}
+
+func (c *readcache) SetStaleWhileRevalidate(window time.Duration) {
+	configure(c, func(cfg *Config) { cfg.StaleWhileRevalidate = window })
+}
+
+func (c *readcache) SetRefetchSampling(n int) {
+	configure(c, func(cfg *Config) { cfg.RefetchSampling = n })
+}
+
+func (c *readcache) SetOnRefresh(onRefresh func(key string, newValue interface{}, err error)) {
+	configure(c, func(cfg *Config) { cfg.OnRefresh = onRefresh })
+}
+
+func (c *readcache) SetInvalidationPublisher(publish func(key string)) {
+	configure(c, func(cfg *Config) { cfg.PublishInvalidation = publish })
+}
+
+func (c *readcache) SetMaxInFlightFetches(maxInFlightFetches int, block bool) {
+	configure(c, func(cfg *Config) {
+		cfg.MaxInFlightFetches = maxInFlightFetches
+		cfg.BlockExcessFetches = block
+	})
+}
+
+func (c *readcache) SetMaxCoalesceBeforeSplit(n int) {
+	configure(c, func(cfg *Config) { cfg.MaxCoalescedWaiters = n })
+}
+
+func (c *readcache) SetConflictResolver(resolver func(key string, existing, incoming SnapshotEntry) SnapshotEntry) {
+	configure(c, func(cfg *Config) { cfg.ConflictResolver = resolver })
+}
+
+func (c *readcache) SetTrackKeyAccess(track bool) {
+	configure(c, func(cfg *Config) { cfg.TrackKeyAccess = track })
+}
+
+func (c *readcache) SetMonotonicExpiry(monotonic bool) {
+	configure(c, func(cfg *Config) { cfg.MonotonicExpiry = monotonic })
+}
+
+func (c *readcache) SetPastExpiryPolicy(policy PastExpiryPolicy, minimumTTL time.Duration) {
+	configure(c, func(cfg *Config) {
+		cfg.PastExpiryPolicy = policy
+		cfg.PastExpiryMinimumTTL = minimumTTL
+	})
+}
+
+func (c *readcache) SetPrefixTTL(prefix string, ttl time.Duration) {
+	configure(c, func(cfg *Config) {
+		prefixTTLs := maps.Clone(cfg.PrefixTTLs)
+		if prefixTTLs == nil {
+			prefixTTLs = make(map[string]time.Duration)
+		}
+		if ttl > 0 {
+			prefixTTLs[prefix] = ttl
+		} else {
+			delete(prefixTTLs, prefix)
+		}
+		cfg.PrefixTTLs = prefixTTLs
+	})
+}
+
+func (c *readcache) SetETagFunc(etagFunc func(value interface{}) string) {
+	configure(c, func(cfg *Config) { cfg.ETagFunc = etagFunc })
+}
+
+func (c *readcache) SetNodeID(id string) {
+	configure(c, func(cfg *Config) { cfg.NodeID = id })
+}
+
+func (c *readcache) SetPriorityTier(prefix string, tier int) {
+	configure(c, func(cfg *Config) {
+		priorityTiers := maps.Clone(cfg.PriorityTiers)
+		if priorityTiers == nil {
+			priorityTiers = make(map[string]int)
+		}
+		priorityTiers[prefix] = tier
+		cfg.PriorityTiers = priorityTiers
+	})
+}
+
+func (c *readcache) SetWriteBehind(bufferSize int, block bool) {
+	configure(c, func(cfg *Config) {
+		cfg.WriteBehindBuffer = bufferSize
+		cfg.BlockWriteBehind = block
+	})
+}
+
+func (c *readcache) SetAsyncEvictCallbacks(workers int, queueSize int, block bool) {
+	configure(c, func(cfg *Config) {
+		cfg.EvictWorkers = workers
+		cfg.EvictQueueSize = queueSize
+		cfg.BlockEvictCallbacks = block
+	})
+}
+
+func (c *readcache) SetValueCodec(codec Codec) {
+	configure(c, func(cfg *Config) { cfg.ValueCodec = codec })
+}
+
+func (c *readcache) SetCompressionThreshold(bytes int) {
+	configure(c, func(cfg *Config) { cfg.CompressionThreshold = bytes })
+}
+
+func (c *readcache) SetSizer(sizer func(value interface{}) int64) {
+	configure(c, func(cfg *Config) { cfg.Sizer = sizer })
+}
+
+func (c *readcache) SetMaxEntryBytes(limit int64) {
+	configure(c, func(cfg *Config) { cfg.MaxEntryBytes = limit })
+}
+
+func (c *readcache) SetValidator(validator func(key string, value interface{}) bool) {
+	configure(c, func(cfg *Config) { cfg.Validator = validator })
+}
+
+func (c *readcache) SetWeakValues(weak bool) {
+	configure(c, func(cfg *Config) { cfg.WeakValues = weak })
+}
+
+func (c *readcache) SetInterning(hash func(value interface{}) string, equals func(a, b interface{}) bool) {
+	configure(c, func(cfg *Config) {
+		if hash == nil || equals == nil {
+			hash, equals = nil, nil
+		}
+		cfg.InterningHash = hash
+		cfg.Interning = equals
+	})
+}
+
+func (c *readcache) SetSuppressRedundantSet(equals func(a, b interface{}) bool) {
+	configure(c, func(cfg *Config) { cfg.SuppressRedundantSet = equals })
+}
+
+// Find the TTL configured for the longest prefix of a key, if any.
+func prefixTTL(cfg *Config, key string) (time.Duration, bool) {
+	return longestPrefixMatch(cfg.PrefixTTLs, key)
+}
+
+// Find the value configured for the longest prefix of a key, if any.
+func longestPrefixMatch[V any](byPrefix map[string]V, key string) (value V, ok bool) {
+	longest := -1
+	for prefix, prefixValue := range byPrefix {
+		if len(prefix) > longest && strings.HasPrefix(key, prefix) {
+			longest, value, ok = len(prefix), prefixValue, true
+		}
+	}
+	return
+}
+
+// Get the current settings.  The settings must not be modified.
+func settings(c *readcache) *Config {
+	c.SettingsLock.RLock()
+	cfg := c.Settings
+	c.SettingsLock.RUnlock()
+	return cfg
+}
+
+// Replace the current settings with an updated copy.
+func configure(c *readcache, update func(cfg *Config)) {
+	c.SettingsLock.Lock()
+	updated := *c.Settings
+	update(&updated)
+	c.Settings = &updated
+	c.SettingsLock.Unlock()
+}
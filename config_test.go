@@ -0,0 +1,105 @@
+package readcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconfigure_BetweenFetches_ShouldUseNewGetter(t *testing.T) {
+	cache := New(newGetter("old", 100e9))
+	cache.Get("1")
+	cfg := cache.Config()
+	cfg.Getter = newGetter("new", 100e9)
+	cache.Reconfigure(cfg)
+
+	if result, _ := cache.Get("1"); result != "old" {
+		t.Errorf("Expected the cached item to be kept, but got %v", result)
+	}
+	if result, _ := cache.Get("2"); result != "new" {
+		t.Errorf("Expected the new getter to be used, but got %v", result)
+	}
+}
+
+func TestReconfigure_DuringFetch_ShouldNotDisturbCoalescedFetch(t *testing.T) {
+	release := make(chan bool)
+	fetchCount := 0
+	oldGetter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		<-release
+		return "old", time.Now().Add(100e9), nil
+	}
+	newGetterCalled := false
+	cache := New(oldGetter)
+
+	results := make(chan interface{}, 2)
+	go func() {
+		result, _ := cache.Get("key")
+		results <- result
+	}()
+	waitForReadControl(t, cache, "key")
+
+	cfg := cache.Config()
+	cfg.Getter = func(key string) (interface{}, time.Time, error) {
+		newGetterCalled = true
+		return "new", time.Now().Add(100e9), nil
+	}
+	cache.Reconfigure(cfg)
+	go func() {
+		result, _ := cache.Get("key")
+		results <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "old" {
+			t.Errorf("Expected the in-flight fetch's result, but got %v", result)
+		}
+	}
+	if fetchCount != 1 || newGetterCalled {
+		t.Errorf("Expected a single fetch by the old getter, but got %d fetches (new getter called: %v)", fetchCount, newGetterCalled)
+	}
+}
+
+func TestReconfigure_PurgeThresholds_ShouldTakeEffect(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cfg := cache.Config()
+	cfg.PurgeAt = 3
+	cfg.PurgeTo = 1
+	cache.Reconfigure(cfg)
+	cache.Get("1")
+	cache.Get("2")
+	cache.Get("3")
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Errorf("Expected a purge down to 1 entry but got %d", stats.Entries)
+	}
+}
+
+func TestConfig_ShouldReflectSetters(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(10)
+	cache.SetErrorBackoff(time.Second)
+	cache.AddObserver(&recordingObserver{})
+	cfg := cache.Config()
+	if cfg.PurgeAt != 10 || cfg.ErrorBackoff != time.Second || len(cfg.Observers) != 1 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if !cfg.CacheNilValues {
+		t.Error("Expected nil values to be cached by default")
+	}
+}
+
+// waitForReadControl waits until a fetch is in flight for the given key.
+func waitForReadControl(t *testing.T, cache Cache, key string) {
+	c := cache.(*readcache)
+	for i := 0; i < 1000; i++ {
+		c.ReadControlsLock.RLock()
+		_, ok := c.ReadControls[key]
+		c.ReadControlsLock.RUnlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("No fetch started for %s", key)
+}
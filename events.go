@@ -0,0 +1,81 @@
+package readcache
+
+import (
+	"sync"
+	"time"
+)
+
+// The kinds of event reported to observers.
+const (
+	eventHit = iota
+	eventMiss
+	eventFetch
+	eventEvict
+)
+
+// Type observedEvent is an event reported to observers, as retained by the
+// event buffer.
+type observedEvent struct {
+	Kind     int
+	Key      string
+	Duration time.Duration
+	Error    error
+	Reason   EvictionReason
+}
+
+// Type eventBuffer retains the most recent events reported to observers, so
+// that they can be replayed to observers registered later.
+type eventBuffer struct {
+	// Locks the buffered events for reads or writes
+	Lock *sync.Mutex
+
+	// The buffered events, oldest first
+	Events []observedEvent
+}
+
+func newEventBuffer() *eventBuffer {
+	return &eventBuffer{Lock: new(sync.Mutex)}
+}
+
+// Buffer an event, discarding the oldest events if more than the given
+// number are buffered.  The lock is held only to append the event, so that
+// event producers are never held up for long.
+func (b *eventBuffer) record(size int, event observedEvent) {
+	if size <= 0 {
+		return
+	}
+	b.Lock.Lock()
+	b.Events = append(b.Events, event)
+	if excess := len(b.Events) - size; excess > 0 {
+		b.Events = b.Events[excess:]
+	}
+	b.Lock.Unlock()
+}
+
+// Discard the oldest events if more than the given number are buffered.
+func (b *eventBuffer) trim(size int) {
+	b.Lock.Lock()
+	b.Events = b.Events[len(b.Events)-min(max(size, 0), len(b.Events)):]
+	b.Lock.Unlock()
+}
+
+// Copy the buffered events, oldest first.
+func (b *eventBuffer) events() []observedEvent {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return append([]observedEvent(nil), b.Events...)
+}
+
+// Report an event to an observer.
+func (e observedEvent) replay(observer Observer) {
+	switch e.Kind {
+	case eventHit:
+		observer.OnHit(e.Key)
+	case eventMiss:
+		observer.OnMiss(e.Key)
+	case eventFetch:
+		observer.OnFetch(e.Key, e.Duration, e.Error)
+	case eventEvict:
+		observer.OnEvict(e.Key, e.Reason)
+	}
+}
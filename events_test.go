@@ -0,0 +1,48 @@
+package readcache
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAddObserver_WithEventBuffer_ShouldReplayRecentEventsInOrder(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetEventBuffer(4)
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("b")
+
+	observer := &recordingObserver{}
+	cache.AddObserver(observer)
+	expected := []string{"fetch a", "miss b", "fetch b", "hit b"}
+	if !slices.Equal(observer.events, expected) {
+		t.Errorf("Expected %v but got %v", expected, observer.events)
+	}
+
+	cache.Get("a")
+	expected = append(expected, "hit a")
+	if !slices.Equal(observer.events, expected) {
+		t.Errorf("Expected %v but got %v", expected, observer.events)
+	}
+}
+
+func TestAddObserver_WithoutEventBuffer_ShouldReplayNothing(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("%d", i))
+	}
+
+	observer := &recordingObserver{}
+	cache.AddObserver(observer)
+	if len(observer.events) != 0 {
+		t.Errorf("Expected no replayed events but got %v", observer.events)
+	}
+}
@@ -0,0 +1,97 @@
+package readcache
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+// Type evictCallbacks queues calls of the eviction callback, so that they are
+// made by a pool of background workers rather than by the goroutine which
+// removed the items.  The calls for each key are queued for the same worker,
+// so that they are made in order.  Each worker is started when calls are
+// queued for it and stops once its queue is empty.
+type evictCallbacks struct {
+	// Locks the queues for reads or writes
+	Lock *sync.Mutex
+
+	// The queued calls for each worker, oldest first, and whether each worker
+	// is running.  Grown as workers are configured, never shrunk.
+	Pending []*list.List
+	Running []bool
+
+	// Signalled whenever a call is taken from a queue.  Uses Lock.
+	Space *sync.Cond
+
+	// The number of calls dropped because a queue was full
+	Dropped uint64
+}
+
+// Type evictCallback is a queued call of the eviction callback.
+type evictCallback struct {
+	OnEvict func(key string, value interface{}, reason EvictionReason)
+	Key     string
+	Item    *cacheable
+	Reason  EvictionReason
+}
+
+func newEvictCallbacks() *evictCallbacks {
+	lock := new(sync.Mutex)
+	return &evictCallbacks{Lock: lock, Space: sync.NewCond(lock)}
+}
+
+// Queue a call of the eviction callback for its key's worker, dropping it or
+// waiting for space if the worker's queue is full, as configured.
+func (e *evictCallbacks) enqueue(cfg *Config, call *evictCallback) {
+	hash := fnv.New32a()
+	hash.Write([]byte(call.Key))
+	worker := int(hash.Sum32() % uint32(cfg.EvictWorkers))
+
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	for len(e.Pending) < cfg.EvictWorkers {
+		e.Pending = append(e.Pending, list.New())
+		e.Running = append(e.Running, false)
+	}
+	for e.Pending[worker].Len() >= max(cfg.EvictQueueSize, 1) {
+		if !cfg.BlockEvictCallbacks {
+			e.Dropped++
+			if cfg.Logger != nil {
+				cfg.Logger.Warn("readcache: eviction callback dropped", "key", call.Key)
+			}
+			return
+		}
+		e.Space.Wait()
+	}
+	e.Pending[worker].PushBack(call)
+	if !e.Running[worker] {
+		e.Running[worker] = true
+		go e.run(worker)
+	}
+}
+
+// Make a worker's queued calls in order, until its queue is empty.
+func (e *evictCallbacks) run(worker int) {
+	for {
+		e.Lock.Lock()
+		next := e.Pending[worker].Front()
+		if next == nil {
+			e.Running[worker] = false
+			e.Lock.Unlock()
+			return
+		}
+		e.Pending[worker].Remove(next)
+		e.Space.Broadcast()
+		e.Lock.Unlock()
+
+		call := next.Value.(*evictCallback)
+		call.OnEvict(call.Key, decodedValue(call.Item), call.Reason)
+	}
+}
+
+// Report the number of calls dropped because a queue was full.
+func (e *evictCallbacks) dropped() uint64 {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+	return e.Dropped
+}
@@ -0,0 +1,99 @@
+package readcache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet_WithAsyncEvictCallbacks_SlowCallback_ShouldNotBlock(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "value of " + key, time.Now().Add(100e9), nil
+	}
+	unblock := make(chan struct{})
+	var evictions sync.WaitGroup
+	cache := New(getter)
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	cache.SetAsyncEvictCallbacks(2, 100, false)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		<-unblock
+		evictions.Done()
+	})
+
+	start := time.Now()
+	evictions.Add(9)
+	for i := 0; i < 10; i++ {
+		if result, err := cache.Get(fmt.Sprintf("%d", i)); result != fmt.Sprintf("value of %d", i) || err != nil {
+			t.Fatalf("Expected the value of %d but got %v, %v", i, result, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Get not to wait for the eviction callback, but it took %v", elapsed)
+	}
+	close(unblock)
+	evictions.Wait()
+}
+
+func TestDelete_WithAsyncEvictCallbacks_ShouldCallInOrderPerKey(t *testing.T) {
+	var lock sync.Mutex
+	var values []interface{}
+	done := make(chan struct{})
+	cache := NewLazy()
+	cache.SetAsyncEvictCallbacks(4, 100, true)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		lock.Lock()
+		defer lock.Unlock()
+		if key != "key" {
+			return
+		}
+		if values = append(values, value); len(values) == 50 {
+			close(done)
+		}
+	})
+	for i := 0; i < 50; i++ {
+		cache.Set("key", i, time.Now().Add(100e9))
+		cache.Set(fmt.Sprintf("other%d", i), i, time.Now().Add(100e9))
+		cache.Delete("key")
+		cache.Delete(fmt.Sprintf("other%d", i))
+	}
+	<-done
+
+	lock.Lock()
+	defer lock.Unlock()
+	for i, value := range values {
+		if value != i {
+			t.Fatalf("Expected the evictions of key in order, but got %v", values)
+		}
+	}
+}
+
+func TestStats_WithAsyncEvictCallbacks_QueueFull_ShouldDropAndCount(t *testing.T) {
+	unblock := make(chan struct{})
+	cache := NewLazy()
+	cache.SetAsyncEvictCallbacks(1, 2, false)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		<-unblock
+	})
+
+	// The first call is taken by the worker, which blocks on it, and the
+	// next two fill the queue.
+	cache.Set("0", "foo", time.Now().Add(100e9))
+	cache.Delete("0")
+	callbacks := cache.(*readcache).EvictCallbacks
+	for pending := 1; pending != 0; {
+		time.Sleep(time.Millisecond)
+		callbacks.Lock.Lock()
+		pending = callbacks.Pending[0].Len()
+		callbacks.Lock.Unlock()
+	}
+	for i := 1; i < 5; i++ {
+		cache.Set(fmt.Sprintf("%d", i), "foo", time.Now().Add(100e9))
+		cache.Delete(fmt.Sprintf("%d", i))
+	}
+	if dropped := cache.Stats().DroppedEvictCallbacks; dropped != 2 {
+		t.Errorf("Expected 2 dropped callbacks but got %d", dropped)
+	}
+	close(unblock)
+}
@@ -0,0 +1,49 @@
+package readcache
+
+import (
+	"time"
+)
+
+// ValueWithExpiry is an item returned by a fan-out fetcher for a key other
+// than the one it was asked for.
+type ValueWithExpiry struct {
+	Value     interface{}
+	ExpiresAt time.Time
+}
+
+// NewFanOut constructs a new cache whose fetcher may return, along with the
+// item for its key, further items for other keys, such as the items of a list
+// fetched as a whole.  The further items are stored as Set would store them,
+// before the fetched item itself, so that Get finds them without fetching
+// them separately.  They are stored only if the fetch succeeds, and an item
+// returned for the fetched key itself is ignored.
+func NewFanOut(getter func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error)) CacheWithSettings {
+	c := newReadcache(nil)
+	c.Settings.FanOutGetter = getter
+	return c
+}
+
+func (c *readcache) SetFanOutGetter(getter func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error)) {
+	configure(c, func(cfg *Config) {
+		cfg.Getter = nil
+		cfg.ContextGetter = nil
+		cfg.FanOutGetter = getter
+	})
+}
+
+// Adapt a fan-out fetcher to an item fetcher which stores the further items
+// it returns, with the settings of the fetch.
+func fanOutGetter(c *readcache, cfg *Config, getter func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error)) func(string) (interface{}, time.Time, error) {
+	return func(key string) (interface{}, time.Time, error) {
+		value, expiresAt, extra, err := getter(key)
+		if err != nil {
+			return value, expiresAt, err
+		}
+		for extraKey, item := range extra {
+			if extraKey != key {
+				set(c, cfg, extraKey, item.Value, item.ExpiresAt)
+			}
+		}
+		return value, expiresAt, nil
+	}
+}
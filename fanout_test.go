@@ -0,0 +1,73 @@
+package readcache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewFanOut_Get_ShouldCacheSideEntries(t *testing.T) {
+	var fetches atomic.Int32
+	getter := func(key string) (interface{}, time.Time, map[string]ValueWithExpiry, error) {
+		fetches.Add(1)
+		expiresAt := time.Now().Add(100e9)
+		return []string{"5", "6"}, expiresAt, map[string]ValueWithExpiry{
+			"item:5": {"five", expiresAt},
+			"item:6": {"six", expiresAt},
+		}, nil
+	}
+	cache := NewFanOut(getter)
+
+	if _, err := cache.Get("list"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	value, err := cache.Get("item:5")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if value != "five" {
+		t.Errorf("Expected five but got %v", value)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("Expected a single fetch but got %d", n)
+	}
+}
+
+func TestSetFanOutGetter_ErrorInGetter_ShouldNotCacheSideEntries(t *testing.T) {
+	failure := errors.New("Error message")
+	cache := NewLazy()
+	cache.SetFanOutGetter(func(key string) (interface{}, time.Time, map[string]ValueWithExpiry, error) {
+		return nil, time.Now(), map[string]ValueWithExpiry{"item:5": {"five", time.Now().Add(100e9)}}, failure
+	})
+
+	if _, err := cache.Get("list"); !errors.Is(err, failure) {
+		t.Errorf("Expected the getter's error but got %v", err)
+	}
+	if status := cache.Status("item:5"); status != StatusAbsent {
+		t.Errorf("Expected the side entry not to be cached but got %v", status)
+	}
+}
+
+func TestNewFanOut_ReconfiguredDuringFetch_ShouldStoreSideEntriesWithFetchSettings(t *testing.T) {
+	var cache CacheWithSettings
+	getter := func(key string) (interface{}, time.Time, map[string]ValueWithExpiry, error) {
+		cache.SetMaxKeyLength(len("list"))
+		expiresAt := time.Now().Add(100e9)
+		return "list", expiresAt, map[string]ValueWithExpiry{
+			"item:5": {"five", expiresAt},
+		}, nil
+	}
+	cache = NewFanOut(getter)
+
+	if _, err := cache.Get("list"); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	c := cache.(*readcache)
+	c.CacheLock.RLock()
+	item, found := c.Cache["item:5"]
+	c.CacheLock.RUnlock()
+	if !found || item.Value != "five" {
+		t.Errorf("Expected the side entry stored under the settings of the fetch but got %+v", item)
+	}
+}
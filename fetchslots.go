@@ -0,0 +1,136 @@
+package readcache
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// Type fetchSlots limits the number of concurrent fetches.  When every slot
+// is taken, fetches wait in a queue and are granted slots in order of
+// priority, highest first.  Among equal priorities, fetches are granted slots
+// round-robin across keys: a fetch for a key with fewer fetches already
+// holding or waiting for a slot goes first, so that a hot key cannot starve
+// the others, and fetches are otherwise taken in order of arrival.
+type fetchSlots struct {
+	// Locks the slots for reads or writes
+	Lock *sync.Mutex
+
+	// The number of slots taken
+	Active int
+
+	// The fetches waiting for a slot
+	Waiting fetchQueue
+
+	// The arrival number given to the last waiting fetch
+	LastArrival uint64
+
+	// The number of fetches holding or waiting for a slot, by key
+	Outstanding map[string]int
+}
+
+// Type fetchWaiter is a fetch waiting for a slot
+type fetchWaiter struct {
+	Priority int
+	Round    int
+	Arrival  uint64
+
+	// Closed when the fetch is granted a slot
+	Ready chan struct{}
+}
+
+// Type fetchQueue is a heap of waiting fetches, next to be granted a slot first
+type fetchQueue []*fetchWaiter
+
+func (q fetchQueue) Len() int { return len(q) }
+
+func (q fetchQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+	if q[i].Round != q[j].Round {
+		return q[i].Round < q[j].Round
+	}
+	return q[i].Arrival < q[j].Arrival
+}
+
+func (q fetchQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *fetchQueue) Push(x interface{}) { *q = append(*q, x.(*fetchWaiter)) }
+
+func (q *fetchQueue) Pop() interface{} {
+	old := *q
+	waiter := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return waiter
+}
+
+func newFetchSlots() *fetchSlots {
+	return &fetchSlots{Lock: new(sync.Mutex), Outstanding: make(map[string]int)}
+}
+
+// Take a slot for a fetch of a key, waiting with the given priority if all of
+// the given number of slots are taken.  Returns a function which gives the
+// slot back.  A maximum of zero or less means that the number of slots is
+// unlimited.
+func (s *fetchSlots) acquire(maxActive int, priority int, key string) (release func()) {
+	if maxActive <= 0 {
+		return func() {}
+	}
+	release = func() { s.release(key) }
+
+	s.Lock.Lock()
+	round := s.Outstanding[key]
+	s.Outstanding[key]++
+	if s.Active < maxActive && len(s.Waiting) == 0 {
+		s.Active++
+		s.Lock.Unlock()
+		return
+	}
+	s.LastArrival++
+	waiter := &fetchWaiter{Priority: priority, Round: round, Arrival: s.LastArrival, Ready: make(chan struct{})}
+	heap.Push(&s.Waiting, waiter)
+	s.Lock.Unlock()
+
+	<-waiter.Ready
+	return
+}
+
+// Take a slot for a fetch of a key if one is free and no other fetch is
+// waiting for one, without waiting.  Returns the function which gives the
+// slot back, and whether a slot was taken.
+func (s *fetchSlots) tryAcquire(maxActive int, key string) (release func(), ok bool) {
+	if maxActive <= 0 {
+		return func() {}, true
+	}
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.Active >= maxActive || len(s.Waiting) > 0 {
+		return nil, false
+	}
+	s.Active++
+	s.Outstanding[key]++
+	return func() { s.release(key) }, true
+}
+
+// Give back the slot of a fetch of a key, handing it straight to the next
+// waiting fetch if any.
+func (s *fetchSlots) release(key string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if s.Outstanding[key]--; s.Outstanding[key] == 0 {
+		delete(s.Outstanding, key)
+	}
+	if len(s.Waiting) > 0 {
+		close(heap.Pop(&s.Waiting).(*fetchWaiter).Ready)
+		return
+	}
+	s.Active--
+}
+
+// Report the number of fetches waiting for a slot.
+func (s *fetchSlots) waiting() int {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	return len(s.Waiting)
+}
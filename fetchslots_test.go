@@ -0,0 +1,99 @@
+package readcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetWithPriority_SlotsSaturated_ShouldFetchHighPriorityFirst(t *testing.T) {
+	running := make(chan struct{})
+	unblock := make(chan struct{})
+	orderLock := new(sync.Mutex)
+	var order []string
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "busy" {
+			close(running)
+			<-unblock
+		}
+		orderLock.Lock()
+		order = append(order, key)
+		orderLock.Unlock()
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxConcurrentFetches(1)
+	slots := cache.(*readcache).FetchSlots
+
+	var wait sync.WaitGroup
+	getWithPriority := func(key string, priority int) {
+		defer wait.Done()
+		if _, err := cache.GetWithPriority(key, priority); err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+	}
+	waitForWaiting := func(count int) {
+		for slots.waiting() < count {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	wait.Add(3)
+	go getWithPriority("busy", 0)
+	<-running
+	go getWithPriority("low", 1)
+	waitForWaiting(1)
+	go getWithPriority("high", 10)
+	waitForWaiting(2)
+	close(unblock)
+	wait.Wait()
+
+	if len(order) != 3 || order[1] != "high" || order[2] != "low" {
+		t.Errorf("Expected high to be fetched before low but got %v", order)
+	}
+}
+
+func TestFetchSlots_HotKeyFlood_ShouldNotStarveOtherKey(t *testing.T) {
+	slots := newFetchSlots()
+	release := slots.acquire(1, 0, "hot")
+	granted := make(chan string, 12)
+	acquire := func(key string) {
+		release := slots.acquire(1, 0, key)
+		granted <- key
+		release()
+	}
+	for i := 0; i < 10; i++ {
+		go acquire("hot")
+		for slots.waiting() < i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	go acquire("cold")
+	for slots.waiting() < 11 {
+		time.Sleep(time.Millisecond)
+	}
+
+	release()
+	select {
+	case key := <-granted:
+		if key != "cold" {
+			t.Errorf("Expected the waiting fetch of cold to be granted the slot first, but got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a waiting fetch to be granted the slot")
+	}
+}
+
+func TestFetchSlots_Unlimited_ShouldNotWait(t *testing.T) {
+	slots := newFetchSlots()
+	releases := make([]func(), 10)
+	for i := range releases {
+		releases[i] = slots.acquire(0, 0, "key")
+	}
+	for _, release := range releases {
+		release()
+	}
+	if slots.Active != 0 || slots.waiting() != 0 {
+		t.Errorf("Expected no slots to be taken, but got %d active", slots.Active)
+	}
+}
@@ -0,0 +1,41 @@
+package readcache
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"time"
+)
+
+// Type gobEntry is an item as written by WriteGob
+type gobEntry struct {
+	Key       string
+	Value     interface{}
+	ExpiresAt time.Time
+}
+
+func (c *readcache) WriteGob(w io.Writer) error {
+	encoder := gob.NewEncoder(w)
+	for key, entry := range c.Snapshot() {
+		if err := encoder.Encode(gobEntry{key, entry.Value, entry.ExpiresAt}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *readcache) ReadGob(r io.Reader) error {
+	cfg := settings(c)
+	decoder := gob.NewDecoder(r)
+	for {
+		var entry gobEntry
+		if err := decoder.Decode(&entry); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entry.ExpiresAt.After(cfg.Clock.Now()) {
+			set(c, cfg, entry.Key, entry.Value, entry.ExpiresAt)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package readcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+type gobTestValue struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(gobTestValue{})
+}
+
+func TestReadGob_FromWriteGob_ShouldRoundTripUnexpiredItems(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	primary := NewLazy()
+	primary.SetClock(clock)
+	primary.Set("a", gobTestValue{"a", 1}, clock.Now().Add(time.Minute))
+	primary.Set("b", gobTestValue{"b", 2}, clock.Now().Add(time.Hour))
+	primary.Set("expired", gobTestValue{"expired", 3}, clock.Now().Add(-time.Minute))
+
+	var buffer bytes.Buffer
+	if err := primary.WriteGob(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	standby := NewLazy()
+	standby.SetClock(clock)
+	clock.Advance(2 * time.Minute)
+	if err := standby.ReadGob(&buffer); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	if value, found, _ := standby.GetNoFetch("b"); !found || value != (gobTestValue{"b", 2}) {
+		t.Errorf("Expected b to round-trip but got %v, %v", value, found)
+	}
+	if expiry := expiryOf(standby, "b"); !expiry.Equal(clock.Now().Add(time.Hour - 2*time.Minute)) {
+		t.Errorf("Expected b to keep its expiry but got %v", expiry)
+	}
+	for _, key := range []string{"a", "expired"} {
+		if status := standby.Status(key); status != StatusAbsent {
+			t.Errorf("Expected %s to be skipped but got %s", key, status)
+		}
+	}
+}
+
+func TestWriteGob_UnregisteredValueType_ShouldReturnError(t *testing.T) {
+	type unregistered struct{ Name string }
+	cache := NewLazy()
+	cache.Set("a", unregistered{"a"}, time.Now().Add(time.Minute))
+
+	if err := cache.WriteGob(new(bytes.Buffer)); err == nil {
+		t.Errorf("Expected an error for an unregistered value type")
+	}
+}
@@ -0,0 +1,73 @@
+package readcache
+
+import (
+	"context"
+	"time"
+)
+
+// The separator between the group and the key in the key under which an
+// item fetched by GetInGroup is held.
+const groupSeparator = "\x00"
+
+// GroupKey gives the key under which the cache holds the item for a key in a
+// group, as fetched by GetInGroup, so that the item can be used with methods
+// which take a single key, such as Delete.  The group must not contain a NUL
+// character.
+func GroupKey(group, key string) string {
+	return group + groupSeparator + key
+}
+
+func (c *readcache) GetInGroup(group, key string) (interface{}, error) {
+	cfg := settings(c)
+	groupKey := GroupKey(group, key)
+	cachedValue, readControl, err := getOrReadControl(c, cfg, groupKey)
+	if readControl != nil {
+		cachedValue, err = doFetch(c, ungroupedConfig(cfg, group, key), groupKey, readControl, nil, 0)
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+// Copy the settings for a fetch of a key in a group, with the item fetchers
+// given the key alone rather than the key under which the item is held, and
+// the further items of a fan-out fetcher held in the group.
+func ungroupedConfig(cfg *Config, group, key string) *Config {
+	groupCfg := *cfg
+	if cfg.Getter != nil {
+		groupCfg.Getter = func(string) (interface{}, time.Time, error) {
+			return cfg.Getter(key)
+		}
+	}
+	if cfg.ContextGetter != nil {
+		groupCfg.ContextGetter = func(ctx context.Context, _ string) (interface{}, time.Time, error) {
+			return cfg.ContextGetter(ctx, key)
+		}
+	}
+	if cfg.FanOutGetter != nil {
+		// The further items belong to the group too.
+		groupCfg.FanOutGetter = func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error) {
+			value, expiresAt, extra, err := cfg.FanOutGetter(key)
+			grouped := make(map[string]ValueWithExpiry, len(extra))
+			for extraKey, item := range extra {
+				if extraKey != key {
+					grouped[GroupKey(group, extraKey)] = item
+				}
+			}
+			return value, expiresAt, grouped, err
+		}
+	}
+	if cfg.FallbackGetter != nil {
+		groupCfg.FallbackGetter = func(string) (interface{}, time.Time, error) {
+			return cfg.FallbackGetter(key)
+		}
+	}
+	if cfg.CircuitOpenFallback != nil {
+		groupCfg.CircuitOpenFallback = func(string) (interface{}, bool) {
+			return cfg.CircuitOpenFallback(key)
+		}
+	}
+	return &groupCfg
+}
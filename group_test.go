@@ -0,0 +1,78 @@
+package readcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetInGroup_SameKeyInTwoGroups_ShouldFetchAndStoreIndependently(t *testing.T) {
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount[key]++
+		return fetchCount[key], time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	first, _ := cache.GetInGroup("tenant-a", "key")
+	second, _ := cache.GetInGroup("tenant-b", "key")
+	if first != 1 || second != 2 {
+		t.Errorf("Expected independent fetches 1 and 2 but got %v and %v", first, second)
+	}
+	if result, _ := cache.GetInGroup("tenant-a", "key"); result != 1 {
+		t.Errorf("Expected the value 1 cached in the first group but got %v", result)
+	}
+	if result, _ := cache.GetInGroup("tenant-b", "key"); result != 2 {
+		t.Errorf("Expected the value 2 cached in the second group but got %v", result)
+	}
+	if fetchCount["key"] != 2 {
+		t.Errorf("Expected the fetcher to be given the ungrouped key twice but got %v", fetchCount)
+	}
+
+	cache.Delete(GroupKey("tenant-a", "key"))
+	if result, _ := cache.GetInGroup("tenant-a", "key"); result != 3 {
+		t.Errorf("Expected the deleted item to be refetched as 3 but got %v", result)
+	}
+	if result, _ := cache.GetInGroup("tenant-b", "key"); result != 2 {
+		t.Errorf("Expected the value 2 to remain cached in the second group but got %v", result)
+	}
+}
+
+func TestGet_KeyContainingNUL_ShouldReachGetterIntact(t *testing.T) {
+	var fetched []string
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetched = append(fetched, key)
+		return "value of " + key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	first, _ := cache.Get("a\x00b")
+	second, _ := cache.Get("c\x00b")
+	if first != "value of a\x00b" || second != "value of c\x00b" {
+		t.Errorf("Expected the values of the whole keys but got %q and %q", first, second)
+	}
+	if len(fetched) != 2 || fetched[0] != "a\x00b" || fetched[1] != "c\x00b" {
+		t.Errorf("Expected the fetcher to be given the whole keys but got %q", fetched)
+	}
+}
+
+func TestGetInGroup_WithFanOut_ShouldStoreSideEntriesInGroup(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, map[string]ValueWithExpiry, error) {
+		expiresAt := time.Now().Add(100e9)
+		return "list", expiresAt, map[string]ValueWithExpiry{
+			"item:5": {"five", expiresAt},
+		}, nil
+	}
+	cache := NewFanOut(getter)
+
+	if result, err := cache.GetInGroup("tenant-a", "list"); result != "list" || err != nil {
+		t.Fatalf("Expected list but got %v, %v", result, err)
+	}
+	if status := cache.Status(GroupKey("tenant-a", "item:5")); status != StatusFresh {
+		t.Errorf("Expected the side entry to be cached in the group but got %s", status)
+	}
+	for _, key := range []string{GroupKey("tenant-b", "item:5"), "item:5"} {
+		if status := cache.Status(key); status != StatusAbsent {
+			t.Errorf("Expected no side entry at %q but got %s", key, status)
+		}
+	}
+}
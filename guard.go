@@ -0,0 +1,135 @@
+package readcache
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// The number of most recent fetches over which the rate of ErrNotFound
+// results is measured, and the fraction of them above which the penetration
+// guard engages.
+const (
+	guardWindow    = 64
+	guardThreshold = 0.5
+)
+
+// Type penetrationGuard short-circuits fetches of keys which are very likely
+// absent, while fetches keep reporting that keys are not found; see
+// SetPenetrationGuard.  A bloom filter of the keys known to be present tells
+// which keys may be present.
+type penetrationGuard struct {
+	// Locks the guard for reads or writes
+	Lock *sync.Mutex
+
+	// The bloom filter's bits, and the number of bits set for each key.  No
+	// bits means that the guard is disabled.
+	Bits   []uint64
+	Hashes int
+
+	// Whether the outcome of each of the most recent fetches was ErrNotFound,
+	// as a ring starting at Next, how many of them were, and whether the
+	// guard is engaged as a result.
+	Outcomes  []bool
+	Next      int
+	NotFounds int
+	Engaged   bool
+}
+
+func newPenetrationGuard() *penetrationGuard {
+	return &penetrationGuard{Lock: new(sync.Mutex)}
+}
+
+func (c *readcache) SetPenetrationGuard(expectedKeys int, falsePositiveRate float64) {
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	c.Guard.reset(expectedKeys, falsePositiveRate)
+	for key := range c.Cache {
+		c.Guard.add(key)
+	}
+}
+
+// Size the bloom filter for the given number of keys at the given false
+// positive rate, forgetting every key and outcome.  A number of keys of zero
+// or less disables the guard.
+func (g *penetrationGuard) reset(expectedKeys int, falsePositiveRate float64) {
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	g.Bits, g.Hashes = nil, 0
+	g.Outcomes, g.Next, g.NotFounds, g.Engaged = nil, 0, 0, false
+	if expectedKeys <= 0 {
+		return
+	}
+	falsePositiveRate = min(max(falsePositiveRate, 1e-9), 0.5)
+	bits := math.Ceil(-float64(expectedKeys) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	g.Bits = make([]uint64, int(bits)/64+1)
+	g.Hashes = max(int(math.Round(bits/float64(expectedKeys)*math.Ln2)), 1)
+}
+
+// Find the bits of the bloom filter for a key, by double hashing.
+func (g *penetrationGuard) positions(key string) (first, step uint64) {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	sum := hash.Sum64()
+	return sum, sum>>32 | 1
+}
+
+// Record a key as present.
+func (g *penetrationGuard) add(key string) {
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	if g.Bits == nil {
+		return
+	}
+	size := uint64(len(g.Bits) * 64)
+	position, step := g.positions(key)
+	for i := 0; i < g.Hashes; i++ {
+		bit := position % size
+		g.Bits[bit/64] |= 1 << (bit % 64)
+		position += step
+	}
+}
+
+// Determine whether the fetch of a key should be short-circuited, because
+// the guard is engaged and the key is certainly not among those present.
+func (g *penetrationGuard) rejects(key string) bool {
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	if !g.Engaged {
+		return false
+	}
+	size := uint64(len(g.Bits) * 64)
+	position, step := g.positions(key)
+	for i := 0; i < g.Hashes; i++ {
+		bit := position % size
+		if g.Bits[bit/64]&(1<<(bit%64)) == 0 {
+			return true
+		}
+		position += step
+	}
+	return false
+}
+
+// Record the outcome of a fetch, engaging the guard once most of the recent
+// fetches reported that their keys were not found, and disengaging it once
+// most did not.
+func (g *penetrationGuard) record(notFound bool) {
+	g.Lock.Lock()
+	defer g.Lock.Unlock()
+	if g.Bits == nil {
+		return
+	}
+	if len(g.Outcomes) < guardWindow {
+		g.Outcomes = append(g.Outcomes, notFound)
+	} else {
+		if g.Outcomes[g.Next] {
+			g.NotFounds--
+		}
+		g.Outcomes[g.Next] = notFound
+		g.Next = (g.Next + 1) % guardWindow
+	}
+	if notFound {
+		g.NotFounds++
+	}
+	g.Engaged = len(g.Outcomes) == guardWindow && float64(g.NotFounds) > guardThreshold*guardWindow
+}
@@ -0,0 +1,54 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGet_WithPenetrationGuard_ScanningAbsentKeys_ShouldReduceFetches(t *testing.T) {
+	absentFetches := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		if strings.HasPrefix(key, "absent") {
+			absentFetches++
+			return nil, time.Time{}, ErrNotFound
+		}
+		return "value of " + key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetPenetrationGuard(100, 0.01)
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("present%d", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, err := cache.Get(fmt.Sprintf("absent%d", i)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound but got %v", err)
+		}
+	}
+	if absentFetches > 100 {
+		t.Errorf("Expected the guard to short-circuit most of the scan, but got %d fetches", absentFetches)
+	}
+
+	cache.Delete("present3")
+	if result, err := cache.Get("present3"); result != "value of present3" || err != nil {
+		t.Errorf("Expected a known key to be fetched again but got %v, %v", result, err)
+	}
+}
+
+func TestGet_WithoutPenetrationGuard_ScanningAbsentKeys_ShouldFetchEach(t *testing.T) {
+	absentFetches := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		absentFetches++
+		return nil, time.Time{}, ErrNotFound
+	}
+	cache := New(getter)
+	for i := 0; i < 200; i++ {
+		cache.Get(fmt.Sprintf("absent%d", i))
+	}
+	if absentFetches != 200 {
+		t.Errorf("Expected every absent key to be fetched but got %d fetches", absentFetches)
+	}
+}
@@ -0,0 +1,54 @@
+package readcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Type hedgedResult is the result of one of the calls made by hedgedFetch.
+type hedgedResult struct {
+	Value     interface{}
+	ExpiresAt time.Time
+	Err       error
+}
+
+// Call an item fetcher, calling it a second time if the first call has not
+// returned within the configured hedging delay, and return the result of
+// whichever call returns first.  The other call is left to complete in the
+// background, and its result is ignored.  The first call is made under the
+// fetch's slot, given back by the given function; the second takes a slot of
+// its own, and is not made if none is free.  Returns, along with the result,
+// the function which gives back the fetch's slot once the fetch is done with
+// it, which keeps the slot until the first call has returned.
+func hedgedFetch(c *readcache, cfg *Config, getter func(string) (interface{}, time.Time, error), key string, release func()) (hedgedResult, func()) {
+	if cfg.HedgeDelay <= 0 {
+		value, expiresAt, err := getter(key)
+		return hedgedResult{value, expiresAt, err}, release
+	}
+	var holders atomic.Int32
+	holders.Store(2)
+	releaseShared := func() {
+		if holders.Add(-1) == 0 {
+			release()
+		}
+	}
+	results := make(chan hedgedResult, 2)
+	call := func(release func()) {
+		value, expiresAt, err := getter(key)
+		release()
+		results <- hedgedResult{value, expiresAt, err}
+	}
+	go call(releaseShared)
+
+	timer := time.NewTimer(cfg.HedgeDelay)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return result, releaseShared
+	case <-timer.C:
+		if hedgeRelease, ok := c.FetchSlots.tryAcquire(cfg.MaxConcurrentFetches, key); ok {
+			go call(hedgeRelease)
+		}
+	}
+	return <-results, releaseShared
+}
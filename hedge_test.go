@@ -0,0 +1,119 @@
+package readcache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_WithHedging_SlowFirstCall_ShouldUseFasterResult(t *testing.T) {
+	var fetchCount atomic.Int32
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		if fetchCount.Add(1) == 1 {
+			<-unblock
+			return "slow", time.Now().Add(100e9), nil
+		}
+		return "fast", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetHedging(10 * time.Millisecond)
+	defer close(unblock)
+
+	if result, err := cache.Get("key"); result != "fast" || err != nil {
+		t.Errorf("Expected the hedged call's 'fast' but got %v, %v", result, err)
+	}
+	if count := fetchCount.Load(); count != 2 {
+		t.Errorf("Expected 2 calls but got %d", count)
+	}
+	if result, _, _ := cache.GetNoFetch("key"); result != "fast" {
+		t.Errorf("Expected 'fast' to be cached but got %v", result)
+	}
+}
+
+func TestGet_WithHedging_FastFirstCall_ShouldNotHedge(t *testing.T) {
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount.Add(1)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetHedging(time.Second)
+
+	if result, err := cache.Get("key"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+	if count := fetchCount.Load(); count != 1 {
+		t.Errorf("Expected a single call but got %d", count)
+	}
+}
+
+func TestCompute_WithHedging_SlowFn_ShouldRunFnOnce(t *testing.T) {
+	var calls atomic.Int32
+	cache := NewLazy()
+	cache.SetHedging(time.Millisecond)
+
+	result, err := cache.Compute("key", func() (interface{}, time.Time, error) {
+		calls.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	})
+	if result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+	if count := calls.Load(); count != 1 {
+		t.Errorf("Expected fn to run once but it ran %d times", count)
+	}
+}
+
+func TestGet_WithHedging_NoFreeFetchSlot_ShouldNotHedge(t *testing.T) {
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxConcurrentFetches(1)
+	cache.SetHedging(time.Millisecond)
+
+	if result, err := cache.Get("key"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+	if count := fetchCount.Load(); count != 1 {
+		t.Errorf("Expected no hedged call without a free slot but got %d calls", count)
+	}
+	if waiting := cache.(*readcache).FetchSlots.waiting(); waiting != 0 {
+		t.Errorf("Expected no fetch waiting but got %d", waiting)
+	}
+}
+
+func TestGet_WithHedging_HedgeWins_ShouldHoldSlotUntilFirstCallReturns(t *testing.T) {
+	var fetchCount atomic.Int32
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		if fetchCount.Add(1) == 1 {
+			<-unblock
+		}
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxConcurrentFetches(2)
+	cache.SetHedging(time.Millisecond)
+
+	cache.Get("key")
+	slots := cache.(*readcache).FetchSlots
+	slots.Lock.Lock()
+	active := slots.Active
+	slots.Lock.Unlock()
+	if active != 1 {
+		t.Errorf("Expected the slow first call to hold its slot but got %d active", active)
+	}
+	close(unblock)
+	for active != 0 {
+		time.Sleep(time.Millisecond)
+		slots.Lock.Lock()
+		active = slots.Active
+		slots.Lock.Unlock()
+	}
+}
@@ -0,0 +1,77 @@
+package readcache
+
+import (
+	"reflect"
+)
+
+// Type internedHash indexes the keys whose values may be shared; see
+// readcache.Interned.
+type internedHash struct {
+	Type reflect.Type
+	Hash string
+}
+
+// Replace the value of an item just fetched for a key by an equal value
+// already cached for another key, if interning is configured.  Returns the
+// index under which the key is to be recorded, by indexInterned, once the
+// item is stored, and whether it is to be.  The item must not yet be shared.
+// The caller must hold CacheLock for writing.
+func internValue(c *readcache, cfg *Config, key string, item *cacheable) (internedHash, bool) {
+	if cfg.Interning == nil || item.Value == nil {
+		return internedHash{}, false
+	}
+	valueType := reflect.TypeOf(item.Value)
+	index := internedHash{valueType, cfg.InterningHash(item.Value)}
+	for other := range c.Interned[index] {
+		if other == key {
+			continue
+		}
+		cachedValue, ok := c.Cache[other]
+		if !ok || cachedValue.Codec != nil {
+			forgetInterned(c, other)
+			continue
+		}
+		value := strengthenItem(cachedValue).Value
+		if value == nil || reflect.TypeOf(value) != valueType || cfg.InterningHash(value) != index.Hash {
+			forgetInterned(c, other)
+			continue
+		}
+		if cfg.Interning(value, item.Value) {
+			item.Value = value
+			break
+		}
+	}
+	return index, true
+}
+
+// Record the key of an item just stored under the index given by
+// internValue, so that later values may share the item's value in turn.  The
+// caller must hold CacheLock for writing.
+func indexInterned(c *readcache, key string, index internedHash) {
+	if _, ok := c.Cache[key]; !ok {
+		return
+	}
+	forgetInterned(c, key)
+	keys := c.Interned[index]
+	if keys == nil {
+		keys = make(map[string]bool)
+		c.Interned[index] = keys
+	}
+	keys[key] = true
+	c.InternedKeys[key] = index
+}
+
+// Remove a key from the index of values which may be shared.  The caller
+// must hold CacheLock for writing.
+func forgetInterned(c *readcache, key string) {
+	index, ok := c.InternedKeys[key]
+	if !ok {
+		return
+	}
+	delete(c.InternedKeys, key)
+	keys := c.Interned[index]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(c.Interned, index)
+	}
+}
@@ -0,0 +1,102 @@
+package readcache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type internedValue struct {
+	Data string
+}
+
+func hashInternedValue(value interface{}) string {
+	return value.(*internedValue).Data
+}
+
+func newInterningCache() CacheWithSettings {
+	getter := func(key string) (interface{}, time.Time, error) {
+		data, _, _ := strings.Cut(key, "/")
+		return &internedValue{Data: data}, time.Now().Add(100e9), nil
+	}
+	return New(getter)
+}
+
+func TestGet_WithInterning_EqualValues_ShouldShareValue(t *testing.T) {
+	cache := newInterningCache()
+	cache.SetInterning(hashInternedValue, func(a, b interface{}) bool { return reflect.DeepEqual(a, b) })
+
+	first, _ := cache.Get("same/1")
+	for _, key := range []string{"same/2", "same/3"} {
+		if result, _ := cache.Get(key); result != first {
+			t.Errorf("Expected %v to share the value %p but got %p", key, first, result)
+		}
+		if result, _, _ := cache.GetNoFetch(key); result != first {
+			t.Errorf("Expected the cached value of %v to be %p but got %p", key, first, result)
+		}
+	}
+	if result, _ := cache.Get("other/1"); result == first {
+		t.Errorf("Expected an unequal value not to be shared")
+	}
+}
+
+func TestGet_WithoutInterning_EqualValues_ShouldNotShareValue(t *testing.T) {
+	cache := newInterningCache()
+	first, _ := cache.Get("same/1")
+	if second, _ := cache.Get("same/2"); second == first {
+		t.Errorf("Expected distinct values but both were %p", first)
+	}
+}
+
+func TestGet_WithInterning_ShouldCompareOnlyValuesWithTheSameHash(t *testing.T) {
+	cache := newInterningCache()
+	var compared []string
+	cache.SetInterning(hashInternedValue, func(a, b interface{}) bool {
+		compared = append(compared, a.(*internedValue).Data)
+		return reflect.DeepEqual(a, b)
+	})
+
+	for _, key := range []string{"a/1", "b/1", "c/1", "d/1"} {
+		cache.Get(key)
+	}
+	first, _ := cache.Get("b/1")
+	if result, _ := cache.Get("b/2"); result != first {
+		t.Errorf("Expected b/2 to share the value %p but got %p", first, result)
+	}
+	if len(compared) != 1 || compared[0] != "b" {
+		t.Errorf("Expected only the value of b/1 to be compared but got %v", compared)
+	}
+}
+
+func TestGet_WithInterning_NilHash_ShouldNotShareValue(t *testing.T) {
+	cache := newInterningCache()
+	cache.SetInterning(nil, func(a, b interface{}) bool { return reflect.DeepEqual(a, b) })
+	first, _ := cache.Get("same/1")
+	if second, _ := cache.Get("same/2"); second == first {
+		t.Errorf("Expected distinct values but both were %p", first)
+	}
+}
+
+func TestGet_WithInterning_WithPurge_ShouldBoundIndex(t *testing.T) {
+	cache := newInterningCache()
+	cache.SetInterning(hashInternedValue, func(a, b interface{}) bool { return reflect.DeepEqual(a, b) })
+	cache.SetPurgeAt(100)
+	cache.SetPurgeTo(50)
+	for i := 0; i < 2000; i++ {
+		cache.Get(fmt.Sprintf("%d/1", i))
+	}
+	cache.Delete("1999/1")
+
+	c := cache.(*readcache)
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	indexed := 0
+	for _, keys := range c.Interned {
+		indexed += len(keys)
+	}
+	if indexed != len(c.Cache) || len(c.InternedKeys) != len(c.Cache) {
+		t.Errorf("Expected an index entry per cached item, %d, but got %d and %d", len(c.Cache), indexed, len(c.InternedKeys))
+	}
+}
@@ -0,0 +1,17 @@
+package readcache
+
+func (c *readcache) StartInvalidationListener(keys <-chan string) {
+	go func() {
+		for key := range keys {
+			removeWithDependents(c, settings(c), key)
+		}
+	}()
+}
+
+// Report a local write of a key to the invalidation publisher, if one is
+// configured.
+func publishInvalidation(cfg *Config, key string) {
+	if cfg.PublishInvalidation != nil {
+		cfg.PublishInvalidation(key)
+	}
+}
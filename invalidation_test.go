@@ -0,0 +1,57 @@
+package readcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartInvalidationListener_WiredToPublisher_ShouldPropagateInvalidations(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fetchCount, time.Now().Add(100e9), nil
+	}
+	invalidations := make(chan string, 10)
+	writer := NewLazy()
+	writer.SetInvalidationPublisher(func(key string) { invalidations <- key })
+	reader := New(getter)
+	reader.StartInvalidationListener(invalidations)
+	defer close(invalidations)
+	waitForAbsent := func(key string) {
+		for i := 0; i < 1000 && reader.Status(key) != StatusAbsent; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if status := reader.Status(key); status != StatusAbsent {
+			t.Fatalf("Expected %s to be invalidated but got %v", key, status)
+		}
+	}
+
+	reader.Get("set")
+	reader.Get("deleted")
+	writer.Set("set", "bar", time.Now().Add(100e9))
+	waitForAbsent("set")
+	writer.Delete("deleted")
+	waitForAbsent("deleted")
+
+	if result, _ := reader.Get("set"); result != 3 {
+		t.Errorf("Expected the invalidated item to be refetched as 3 but got %v", result)
+	}
+	if result, _ := writer.Get("set"); result != "bar" {
+		t.Errorf("Expected the writer to keep its own item but got %v", result)
+	}
+}
+
+func TestStartInvalidationListener_ShouldNotPublishReceivedInvalidations(t *testing.T) {
+	published := make(chan string, 10)
+	invalidations := make(chan string)
+	cache := NewLazy()
+	cache.SetInvalidationPublisher(func(key string) { published <- key })
+	cache.StartInvalidationListener(invalidations)
+	invalidations <- "key"
+	close(invalidations)
+
+	cache.Delete("local")
+	if key := <-published; key != "local" {
+		t.Errorf("Expected only the local delete to be published but got %s", key)
+	}
+}
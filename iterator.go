@@ -0,0 +1,56 @@
+package readcache
+
+// CacheIterator visits the items in a cache one at a time; see Iterator.
+type CacheIterator struct {
+	cache *readcache
+	keys  []string
+	key   string
+	entry SnapshotEntry
+}
+
+func (c *readcache) Iterator() *CacheIterator {
+	c.CacheLock.RLock()
+	keys := make([]string, 0, len(c.Cache))
+	for key := range c.Cache {
+		keys = append(keys, key)
+	}
+	c.CacheLock.RUnlock()
+
+	return &CacheIterator{cache: c, keys: keys}
+}
+
+// Advance to the next item, returning false once every key has been visited.
+// Keys whose items have been removed or have expired since the iterator was
+// created are skipped.
+func (it *CacheIterator) Next() bool {
+	c := it.cache
+	cfg := settings(c)
+	for len(it.keys) > 0 {
+		key := it.keys[0]
+		it.keys = it.keys[1:]
+
+		c.CacheLock.RLock()
+		item, ok := c.Cache[key]
+		c.CacheLock.RUnlock()
+		if !ok {
+			continue
+		}
+		now := cfg.Clock.Now()
+		if expiresAt := expiryTime(c, cfg, item, now); expiresAt.After(now) {
+			it.key, it.entry = key, SnapshotEntry{decodedValue(item), expiresAt}
+			return true
+		}
+	}
+	it.key, it.entry = "", SnapshotEntry{}
+	return false
+}
+
+// The key of the current item.
+func (it *CacheIterator) Key() string {
+	return it.key
+}
+
+// The current item, as it was when Next reached it.
+func (it *CacheIterator) Entry() SnapshotEntry {
+	return it.entry
+}
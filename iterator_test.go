@@ -0,0 +1,68 @@
+package readcache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIterator_WithConcurrentDeletes_ShouldVisitEachRemainingKeyOnce(t *testing.T) {
+	cache := NewLazy()
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("%d", i), i, time.Now().Add(100e9))
+	}
+	it := cache.Iterator()
+
+	var wait sync.WaitGroup
+	wait.Add(1)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i += 2 {
+			cache.Delete(fmt.Sprintf("%d", i))
+		}
+	}()
+	seen := make(map[string]bool)
+	for it.Next() {
+		if seen[it.Key()] {
+			t.Errorf("Expected %s to be visited once", it.Key())
+		}
+		seen[it.Key()] = true
+		if it.Key() != fmt.Sprintf("%d", it.Entry().Value) {
+			t.Errorf("Expected the value of %s but got %v", it.Key(), it.Entry().Value)
+		}
+	}
+	wait.Wait()
+
+	for i := 1; i < 100; i += 2 {
+		if !seen[fmt.Sprintf("%d", i)] {
+			t.Errorf("Expected the undeleted key %d to be visited", i)
+		}
+	}
+	if it := cache.Iterator(); countVisited(it) != 50 {
+		t.Errorf("Expected a new iterator to skip the deleted keys")
+	}
+}
+
+func TestIterator_ExpiredItem_ShouldBeSkipped(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	cache := NewLazy()
+	cache.SetClock(clock)
+	cache.Set("fresh", 1, clock.Now().Add(time.Hour))
+	cache.Set("expiring", 2, clock.Now().Add(time.Minute))
+	it := cache.Iterator()
+	clock.Advance(2 * time.Minute)
+
+	if !it.Next() || it.Key() != "fresh" || it.Next() {
+		t.Errorf("Expected only the fresh item to be visited")
+	}
+}
+
+// countVisited reports the number of items an iterator visits.
+func countVisited(it *CacheIterator) int {
+	n := 0
+	for it.Next() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,140 @@
+package readcache
+
+import "time"
+
+// L2 is a secondary store for items, such as a shared network cache or a
+// local file, which is consulted before the item fetcher when an item is not
+// in the cache.  Items fetched by the item fetcher or stored by Set are written
+// through to it.  Implementations must be safe for concurrent use.
+type L2 interface {
+	// Load the item for a key.  Returns false if the store has no item for the key.
+	Load(key string) (value interface{}, expiresAt time.Time, ok bool, err error)
+
+	// Store the item for a key, replacing any existing item.
+	Store(key string, value interface{}, expiresAt time.Time) error
+
+	// Remove the item for a key, if there is one.
+	Delete(key string) error
+}
+
+// OriginL2 is an L2 store which also keeps the origin of each item, so that
+// items loaded from it report the node which stored them; see GetWithOrigin.
+// An L2 store which implements it is always used through its origin methods.
+type OriginL2 interface {
+	L2
+
+	// Load the item for a key, as Load does, along with its origin.
+	LoadWithOrigin(key string) (value interface{}, expiresAt time.Time, origin Origin, ok bool, err error)
+
+	// Store the item for a key, as Store does, along with its origin.
+	StoreWithOrigin(key string, value interface{}, expiresAt time.Time, origin Origin) error
+}
+
+// Origin describes where and when an item originated: the node which fetched
+// or set it, as configured by SetNodeID, and the time it did so.
+type Origin struct {
+	Node string
+	Time time.Time
+}
+
+// Load an unexpired item from the spill store or the L2 store, whichever has
+// it first, reporting where it was found.  An item loaded from the spill
+// store is removed from it, since it is moved back into the cache.
+func loadFromStores(cfg *Config, key string) (*cacheable, Source, bool) {
+	if cfg.SpillStore != nil {
+		if item, ok := loadFromStore(cfg, cfg.SpillStore, key); ok {
+			dropSpilled(cfg, []string{key})
+			return item, SourceSpill, true
+		}
+	}
+	if cfg.L2 != nil {
+		if item, ok := loadFromStore(cfg, cfg.L2, key); ok {
+			return item, SourceL2, true
+		}
+	}
+	return nil, SourceL2, false
+}
+
+// Load an unexpired item from a store.  Errors are logged and treated as the
+// store not having the item, so that the item fetcher is used instead.
+func loadFromStore(cfg *Config, store L2, key string) (*cacheable, bool) {
+	var value interface{}
+	var expiresAt time.Time
+	var origin Origin
+	var ok bool
+	var err error
+	if originStore, isOriginStore := store.(OriginL2); isOriginStore {
+		value, expiresAt, origin, ok, err = originStore.LoadWithOrigin(key)
+	} else {
+		value, expiresAt, ok, err = store.Load(key)
+	}
+	if err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.Warn("readcache: L2 load failed", "key", key, "error", err)
+		}
+		return nil, false
+	}
+	if !ok || !expiresAt.After(cfg.Clock.Now()) {
+		return nil, false
+	}
+	item := newItem(cfg, value, expiresAt)
+	item.Origin = origin
+	return item, true
+}
+
+// Write an item through to the L2 store, if one is configured, queueing the
+// write if writes are made behind.  Any copy of an earlier item for the key
+// in the spill store is removed, since the item supersedes it.
+func storeToL2(c *readcache, cfg *Config, key string, item *cacheable) {
+	dropSpilled(cfg, []string{key})
+	if cfg.L2 == nil {
+		return
+	}
+	if cfg.WriteBehindBuffer > 0 {
+		c.WriteBehind.enqueue(&l2Write{cfg, []string{key}, item})
+		return
+	}
+	storeToL2Now(cfg, key, item)
+}
+
+// Write an item through to the L2 store.  Errors are logged, since the item is
+// still held by the cache itself.
+func storeToL2Now(cfg *Config, key string, item *cacheable) {
+	storeToStore(cfg, cfg.L2, key, item)
+}
+
+// Write an item to a store.  Errors are logged, since the item is still held
+// by the cache itself.
+func storeToStore(cfg *Config, store L2, key string, item *cacheable) {
+	var err error
+	if originStore, ok := store.(OriginL2); ok {
+		err = originStore.StoreWithOrigin(key, item.Value, item.ExpiresAt, item.Origin)
+	} else {
+		err = store.Store(key, item.Value, item.ExpiresAt)
+	}
+	if err != nil && cfg.Logger != nil {
+		cfg.Logger.Warn("readcache: L2 store failed", "key", key, "error", err)
+	}
+}
+
+// Remove items from the L2 store, if one is configured, queueing the removal
+// if writes are made behind, so that it follows any queued writes of the items.
+func deleteFromL2(c *readcache, cfg *Config, keys []string) {
+	if cfg.L2 == nil {
+		return
+	}
+	if cfg.WriteBehindBuffer > 0 {
+		c.WriteBehind.enqueue(&l2Write{cfg, keys, nil})
+		return
+	}
+	deleteFromL2Now(cfg, keys)
+}
+
+// Remove items from the L2 store.
+func deleteFromL2Now(cfg *Config, keys []string) {
+	for _, key := range keys {
+		if err := cfg.L2.Delete(key); err != nil && cfg.Logger != nil {
+			cfg.Logger.Warn("readcache: L2 delete failed", "key", key, "error", err)
+		}
+	}
+}
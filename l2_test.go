@@ -0,0 +1,269 @@
+package readcache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet_WithL2_ItemInL2_ShouldNotFetch(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	l2 := newMapL2()
+	l2.Store("key", "from l2", time.Now().Add(100e9))
+	cache := New(getter)
+	cache.SetL2(l2)
+
+	result, err := cache.Get("key")
+	if result != "from l2" || err != nil {
+		t.Errorf("Expected 'from l2' but got %v, %v", result, err)
+	}
+	if fetchCount != 0 {
+		t.Errorf("Should not have fetched, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithL2_ExpiredItemInL2_ShouldFetch(t *testing.T) {
+	l2 := newMapL2()
+	l2.Store("key", "from l2", time.Now().Add(-1))
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+
+	if result, _ := cache.Get("key"); result != "foo" {
+		t.Errorf("Expected 'foo' but got %v", result)
+	}
+}
+
+func TestGet_WithL2_ShouldWriteFetchedItemThrough(t *testing.T) {
+	l2 := newMapL2()
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+	cache.Get("key")
+	cache.Set("other", "bar", time.Now().Add(100e9))
+
+	if value, _, ok, _ := l2.Load("key"); !ok || value != "foo" {
+		t.Errorf("Expected the fetched item in the L2 store, but got %v, %v", value, ok)
+	}
+	if value, _, ok, _ := l2.Load("other"); !ok || value != "bar" {
+		t.Errorf("Expected the set item in the L2 store, but got %v, %v", value, ok)
+	}
+}
+
+func TestDelete_WithL2_ShouldDeleteFromL2(t *testing.T) {
+	l2 := newMapL2()
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+	cache.AddDependency("dependent", "key")
+	cache.Get("key")
+	cache.Get("dependent")
+	cache.Delete("key")
+
+	for _, key := range []string{"key", "dependent"} {
+		if _, _, ok, _ := l2.Load(key); ok {
+			t.Errorf("Expected %s to be deleted from the L2 store", key)
+		}
+	}
+}
+
+func TestGet_WithL2_WithWriteBehind_ShouldNotWaitForWrite(t *testing.T) {
+	l2 := &blockingL2{mapL2: newMapL2(), unblock: make(chan struct{})}
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+	cache.SetWriteBehind(10, true)
+
+	if result, err := cache.Get("key"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+	if _, _, ok, _ := l2.Load("key"); ok {
+		t.Error("Expected the L2 write not to have completed yet")
+	}
+	close(l2.unblock)
+	for i := 0; i < 1000; i++ {
+		if value, _, ok, _ := l2.Load("key"); ok {
+			if value != "foo" {
+				t.Errorf("Expected 'foo' in the L2 store but got %v", value)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Expected the L2 store to eventually receive the write")
+}
+
+func TestSet_WithL2_WithWriteBehind_QueueFull_ShouldDropAndCount(t *testing.T) {
+	l2 := &blockingL2{mapL2: newMapL2(), unblock: make(chan struct{})}
+	cache := NewLazy()
+	cache.SetL2(l2)
+	cache.SetWriteBehind(2, false)
+
+	// The first write is taken by the worker, which blocks on it, and the
+	// next two fill the queue.
+	cache.Set("0", "foo", time.Now().Add(100e9))
+	writeBehind := cache.(*readcache).WriteBehind
+	for pending := 1; pending != 0; {
+		time.Sleep(time.Millisecond)
+		writeBehind.Lock.Lock()
+		pending = writeBehind.Pending.Len()
+		writeBehind.Lock.Unlock()
+	}
+	for i := 1; i < 5; i++ {
+		cache.Set(fmt.Sprintf("%d", i), "foo", time.Now().Add(100e9))
+	}
+	if dropped := cache.Stats().DroppedL2Writes; dropped != 2 {
+		t.Errorf("Expected 2 dropped writes but got %d", dropped)
+	}
+	close(l2.unblock)
+}
+
+func TestDelete_WithL2_WithWriteBehind_QueueFull_ShouldWaitRatherThanDrop(t *testing.T) {
+	l2 := &blockingL2{mapL2: newMapL2(), unblock: make(chan struct{})}
+	l2.mapL2.Store("key", "old", time.Now().Add(100e9))
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "new", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetL2(l2)
+	cache.SetWriteBehind(2, false)
+
+	// The first write is taken by the worker, which blocks on it, and the
+	// next two fill the queue.
+	cache.Set("0", "foo", time.Now().Add(100e9))
+	writeBehind := cache.(*readcache).WriteBehind
+	for pending := 1; pending != 0; {
+		time.Sleep(time.Millisecond)
+		writeBehind.Lock.Lock()
+		pending = writeBehind.Pending.Len()
+		writeBehind.Lock.Unlock()
+	}
+	cache.Set("1", "foo", time.Now().Add(100e9))
+	cache.Set("2", "foo", time.Now().Add(100e9))
+	deleted := make(chan struct{})
+	go func() {
+		cache.Delete("key")
+		close(deleted)
+	}()
+	select {
+	case <-deleted:
+		t.Error("Expected the deletion to wait for space in the queue")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(l2.unblock)
+	<-deleted
+	for running := true; running; {
+		time.Sleep(time.Millisecond)
+		writeBehind.Lock.Lock()
+		running = writeBehind.Running
+		writeBehind.Lock.Unlock()
+	}
+
+	if result, err := cache.Get("key"); result != "new" || err != nil || fetchCount != 1 {
+		t.Errorf("Expected the deleted item to be fetched as 'new' but got %v, %v after %d fetches", result, err, fetchCount)
+	}
+	if dropped := cache.Stats().DroppedL2Writes; dropped != 0 {
+		t.Errorf("Expected no dropped writes but got %d", dropped)
+	}
+}
+
+func TestGetWithOrigin_WithOriginL2_ShouldSurfaceOriginFromL2(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	writtenAt := clock.Now().Add(-time.Minute)
+	l2 := &originMapL2{mapL2: newMapL2(), origins: make(map[string]Origin)}
+	l2.StoreWithOrigin("remote", "from l2", clock.Now().Add(100e9), Origin{"node-b", writtenAt})
+	cache := New(newGetter("foo", 100e9))
+	cache.SetClock(clock)
+	cache.SetL2(l2)
+	cache.SetNodeID("node-a")
+
+	value, origin, _ := cache.GetWithOrigin("remote")
+	if value != "from l2" || origin != (Origin{"node-b", writtenAt}) {
+		t.Errorf("Expected 'from l2' from node-b at %v but got %v from %+v", writtenAt, value, origin)
+	}
+	value, origin, _ = cache.GetWithOrigin("local")
+	if value != "foo" || origin != (Origin{"node-a", clock.Now()}) {
+		t.Errorf("Expected 'foo' from node-a at %v but got %v from %+v", clock.Now(), value, origin)
+	}
+	if stored := l2.origins["local"]; stored != origin {
+		t.Errorf("Expected the fetched item's origin %+v in the L2 store but got %+v", origin, stored)
+	}
+}
+
+func TestGetWithOrigin_WithPlainL2_ShouldGiveZeroOrigin(t *testing.T) {
+	l2 := newMapL2()
+	l2.Store("key", "from l2", time.Now().Add(100e9))
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+	cache.SetNodeID("node-a")
+
+	if _, origin, _ := cache.GetWithOrigin("key"); origin != (Origin{}) {
+		t.Errorf("Expected an unknown origin but got %+v", origin)
+	}
+}
+
+// originMapL2 is an in-memory L2 store which keeps the origin of each item.
+type originMapL2 struct {
+	*mapL2
+	origins map[string]Origin
+}
+
+func (l *originMapL2) LoadWithOrigin(key string) (interface{}, time.Time, Origin, bool, error) {
+	value, expiresAt, ok, err := l.mapL2.Load(key)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return value, expiresAt, l.origins[key], ok, err
+}
+
+func (l *originMapL2) StoreWithOrigin(key string, value interface{}, expiresAt time.Time, origin Origin) error {
+	l.mapL2.Store(key, value, expiresAt)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.origins[key] = origin
+	return nil
+}
+
+// blockingL2 is an L2 store whose writes wait until unblocked.
+type blockingL2 struct {
+	*mapL2
+	unblock chan struct{}
+}
+
+func (l *blockingL2) Store(key string, value interface{}, expiresAt time.Time) error {
+	<-l.unblock
+	return l.mapL2.Store(key, value, expiresAt)
+}
+
+// mapL2 is an in-memory L2 store.
+type mapL2 struct {
+	lock  sync.Mutex
+	items map[string]cacheable
+}
+
+func newMapL2() *mapL2 {
+	return &mapL2{items: make(map[string]cacheable)}
+}
+
+func (l *mapL2) Load(key string) (interface{}, time.Time, bool, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	item, ok := l.items[key]
+	return item.Value, item.ExpiresAt, ok, nil
+}
+
+func (l *mapL2) Store(key string, value interface{}, expiresAt time.Time) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.items[key] = cacheable{Value: value, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (l *mapL2) Delete(key string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.items, key)
+	return nil
+}
@@ -0,0 +1,18 @@
+/*
+Package mmapstore implements a file-backed store for cached items, suitable for
+use as a readcache L2 store so that cached items survive a process restart.
+
+Items are appended to a memory-mapped file as gob-encoded records, and the file
+is scanned when it is opened to rebuild an index of unexpired items.  Because
+values are gob-encoded, their concrete types must be registered with
+gob.Register unless they are basic types.
+
+A Store is safe for concurrent use within a single process.  Coordinating
+access to the same file from several processes is not supported: open a file
+from at most one process at a time.
+
+The file only grows; rewritten and deleted items are superseded by later
+records rather than removed.  The memory-mapped implementation is available
+on unix systems only.
+*/
+package mmapstore
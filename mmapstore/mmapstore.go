@@ -0,0 +1,258 @@
+//go:build unix
+
+package mmapstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The size of a newly created file, and the minimum amount by which it grows.
+const initialSize = 64 * 1024
+
+// The size of the length prefix preceding each record.
+const lengthSize = 4
+
+// ErrClosed is returned when a closed store is used.
+var ErrClosed = errors.New("mmapstore: store is closed")
+
+// Map a file into memory; replaced by tests.
+var mmap = syscall.Mmap
+
+// Store is a file-backed store of items with expiration times.
+type Store struct {
+	// Locks the mapping and index for reads or writes
+	lock *sync.RWMutex
+
+	// The backing file
+	file *os.File
+
+	// The memory mapping of the backing file
+	data []byte
+
+	// The offset at which the next record will be written
+	end int
+
+	// The offset of the most recent record for each unexpired item
+	index map[string]int
+}
+
+// Type record is an entry in the backing file.  Later records for a key
+// supersede earlier ones.
+type record struct {
+	Key       string
+	Value     interface{}
+	ExpiresAt time.Time
+	Deleted   bool
+}
+
+// Open the store backed by the file at the given path, creating the file if
+// it does not exist.  Items which have expired are not loaded.
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := int(info.Size())
+	if size < initialSize {
+		size = initialSize
+		if err := file.Truncate(int64(size)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	data, err := mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s := &Store{new(sync.RWMutex), file, data, 0, make(map[string]int)}
+	if err := s.scan(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load the item for a key.  Returns false if there is no unexpired item.
+func (s *Store) Load(key string) (interface{}, time.Time, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.data == nil {
+		return nil, time.Time{}, false, ErrClosed
+	}
+	offset, ok := s.index[key]
+	if !ok {
+		return nil, time.Time{}, false, nil
+	}
+	r, _, err := s.read(offset)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if !r.ExpiresAt.After(time.Now()) {
+		return nil, time.Time{}, false, nil
+	}
+	return r.Value, r.ExpiresAt, true, nil
+}
+
+// Store the item for a key, replacing any existing item.
+func (s *Store) Store(key string, value interface{}, expiresAt time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	offset, err := s.append(&record{Key: key, Value: value, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	s.index[key] = offset
+	return nil
+}
+
+// Remove the item for a key, if there is one.
+func (s *Store) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	if _, err := s.append(&record{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	delete(s.index, key)
+	return nil
+}
+
+// Close the store, unmapping and closing the backing file.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.data == nil {
+		return ErrClosed
+	}
+	err := syscall.Munmap(s.data)
+	s.data = nil
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Read every record in the backing file to rebuild the index.  A record which
+// was only partially written, or cannot be decoded, ends the scan; it and
+// everything after it are treated as free space, and zeroed so that later
+// appends are not followed by its remains.
+func (s *Store) scan() error {
+	now := time.Now()
+	for {
+		r, next, err := s.read(s.end)
+		if err != nil || r == nil {
+			// Only a zero length marks the end of the records.
+			if err != nil || s.end+lengthSize <= len(s.data) && binary.LittleEndian.Uint32(s.data[s.end:]) != 0 {
+				clear(s.data[s.end:])
+			}
+			return nil
+		}
+		if r.Deleted || !r.ExpiresAt.After(now) {
+			delete(s.index, r.Key)
+		} else {
+			s.index[r.Key] = s.end
+		}
+		s.end = next
+	}
+}
+
+// Read the record at the given offset, returning it and the offset of the
+// following record.  Returns a nil record at the end of the records.
+func (s *Store) read(offset int) (*record, int, error) {
+	if offset+lengthSize > len(s.data) {
+		return nil, offset, nil
+	}
+	length := int(binary.LittleEndian.Uint32(s.data[offset:]))
+	start := offset + lengthSize
+	if length == 0 || start+length > len(s.data) {
+		return nil, offset, nil
+	}
+
+	r := new(record)
+	if err := gob.NewDecoder(bytes.NewReader(s.data[start : start+length])).Decode(r); err != nil {
+		return nil, offset, err
+	}
+	return r, start + length, nil
+}
+
+// Write a record after the existing records, growing the backing file if
+// necessary.  Returns the offset of the written record.  The caller must hold
+// the lock for writing.
+func (s *Store) append(r *record) (int, error) {
+	if s.data == nil {
+		return 0, ErrClosed
+	}
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(r); err != nil {
+		return 0, err
+	}
+
+	// Leave room for a zero length after the record, marking the end.
+	required := s.end + lengthSize + buffer.Len() + lengthSize
+	if required > len(s.data) {
+		if err := s.grow(required); err != nil {
+			return 0, err
+		}
+	}
+
+	// The length is written last, so that a record cut short by a crash is
+	// not mistaken for a whole one.
+	offset := s.end
+	end := offset + lengthSize + buffer.Len()
+	copy(s.data[offset+lengthSize:], buffer.Bytes())
+	binary.LittleEndian.PutUint32(s.data[end:], 0)
+	binary.LittleEndian.PutUint32(s.data[offset:], uint32(buffer.Len()))
+	s.end = end
+	return offset, nil
+}
+
+// Grow the backing file and its mapping to at least the given size.  If the
+// file cannot be grown or mapped, the existing records are mapped again, and
+// the store stays usable; if even they cannot be, the store is closed.
+func (s *Store) grow(required int) error {
+	oldSize := len(s.data)
+	size := oldSize
+	for size < required {
+		size += size/2 + initialSize
+	}
+	if err := syscall.Munmap(s.data); err != nil {
+		return err
+	}
+	s.data = nil
+	err := s.file.Truncate(int64(size))
+	if err == nil {
+		s.data, err = mmap(int(s.file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err == nil {
+			return nil
+		}
+	}
+
+	data, mapErr := mmap(int(s.file.Fd()), 0, oldSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if mapErr != nil {
+		s.data = nil
+		s.file.Close()
+		return errors.Join(err, mapErr)
+	}
+	s.data = data
+	return err
+}
@@ -0,0 +1,190 @@
+//go:build unix
+
+package mmapstore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testValue struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(testValue{})
+}
+
+func TestOpen_AfterReopen_ShouldKeepUnexpiredItems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	store := openStore(t, path)
+	store.Store("fresh", "foo", time.Now().Add(100e9))
+	store.Store("struct", testValue{"bar", 3}, time.Now().Add(100e9))
+	store.Store("expired", "baz", time.Now().Add(-1))
+	store.Store("deleted", "qux", time.Now().Add(100e9))
+	store.Delete("deleted")
+	store.Store("replaced", "old", time.Now().Add(100e9))
+	store.Store("replaced", "new", time.Now().Add(100e9))
+	store.Close()
+
+	store = openStore(t, path)
+	defer store.Close()
+	expected := map[string]interface{}{
+		"fresh":    "foo",
+		"struct":   testValue{"bar", 3},
+		"replaced": "new",
+	}
+	for key, value := range expected {
+		got, _, ok, err := store.Load(key)
+		if err != nil || !ok || got != value {
+			t.Errorf("Expected %s = %v but got %v, %v, %v", key, value, got, ok, err)
+		}
+	}
+	for _, key := range []string{"expired", "deleted", "missing"} {
+		if _, _, ok, _ := store.Load(key); ok {
+			t.Errorf("Expected %s to be absent", key)
+		}
+	}
+}
+
+func TestStore_BeyondInitialSize_ShouldGrowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	store := openStore(t, path)
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 256; i++ {
+		if err := store.Store(fmt.Sprintf("%d", i), value, time.Now().Add(100e9)); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+	}
+	store.Close()
+
+	store = openStore(t, path)
+	defer store.Close()
+	for i := 0; i < 256; i++ {
+		if got, _, ok, _ := store.Load(fmt.Sprintf("%d", i)); !ok || got != value {
+			t.Fatalf("Expected item %d to survive reopening", i)
+		}
+	}
+}
+
+func TestStore_Concurrent_ShouldBeSafe(t *testing.T) {
+	store := openStore(t, filepath.Join(t.TempDir(), "cache"))
+	defer store.Close()
+	var wait sync.WaitGroup
+	for r := 0; r < 8; r++ {
+		seed := r
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("%d", (i*seed)%32)
+				store.Store(key, key, time.Now().Add(100e9))
+				if got, _, ok, _ := store.Load(key); ok && got != key {
+					t.Errorf("Expected %s but got %v", key, got)
+				}
+			}
+		}()
+	}
+	wait.Wait()
+}
+
+func TestLoad_AfterClose_ShouldReturnErrClosed(t *testing.T) {
+	store := openStore(t, filepath.Join(t.TempDir(), "cache"))
+	store.Close()
+	if _, _, _, err := store.Load("key"); err != ErrClosed {
+		t.Errorf("Expected ErrClosed but got %v", err)
+	}
+}
+
+func openStore(t *testing.T, path string) *Store {
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error opening store: %s", err.Error())
+	}
+	return store
+}
+
+func TestOpen_TruncatedRecord_ShouldKeepEarlierItems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	store := openStore(t, path)
+	store.Store("whole", "foo", time.Now().Add(100e9))
+	end := store.end
+	store.Store("truncated", strings.Repeat("x", 1024), time.Now().Add(100e9))
+	store.Close()
+	if err := os.Truncate(path, int64(end+lengthSize+16)); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	store = openStore(t, path)
+	if got, _, ok, err := store.Load("whole"); err != nil || !ok || got != "foo" {
+		t.Errorf("Expected the whole record to survive but got %v, %v, %v", got, ok, err)
+	}
+	if _, _, ok, _ := store.Load("truncated"); ok {
+		t.Errorf("Expected the truncated record to be absent")
+	}
+	if err := store.Store("appended", "bar", time.Now().Add(100e9)); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	store.Close()
+
+	store = openStore(t, path)
+	defer store.Close()
+	for key, value := range map[string]string{"whole": "foo", "appended": "bar"} {
+		if got, _, ok, err := store.Load(key); err != nil || !ok || got != value {
+			t.Errorf("Expected %s = %v after reopening but got %v, %v, %v", key, value, got, ok, err)
+		}
+	}
+}
+
+func TestStore_GrowFails_ShouldKeepEarlierItems(t *testing.T) {
+	defer failMmap(func(length int) bool { return length > initialSize })()
+	store := openStore(t, filepath.Join(t.TempDir(), "cache"))
+	defer store.Close()
+	store.Store("small", "foo", time.Now().Add(100e9))
+
+	if err := store.Store("large", strings.Repeat("x", 2*initialSize), time.Now().Add(100e9)); err == nil {
+		t.Fatal("Expected the store to fail to grow")
+	}
+	if got, _, ok, err := store.Load("small"); err != nil || !ok || got != "foo" {
+		t.Errorf("Expected the earlier item to remain but got %v, %v, %v", got, ok, err)
+	}
+	if err := store.Store("other", "bar", time.Now().Add(100e9)); err != nil {
+		t.Errorf("Expected a small item to fit but got %v", err)
+	}
+}
+
+func TestStore_GrowAndRemapFail_ShouldCloseStore(t *testing.T) {
+	store := openStore(t, filepath.Join(t.TempDir(), "cache"))
+	defer failMmap(func(int) bool { return true })()
+
+	if err := store.Store("large", strings.Repeat("x", 2*initialSize), time.Now().Add(100e9)); err == nil {
+		t.Fatal("Expected the store to fail to grow")
+	}
+	if _, _, _, err := store.Load("large"); err != ErrClosed {
+		t.Errorf("Expected ErrClosed from Load but got %v", err)
+	}
+	if err := store.Store("small", "foo", time.Now().Add(100e9)); err != ErrClosed {
+		t.Errorf("Expected ErrClosed from Store but got %v", err)
+	}
+}
+
+// failMmap makes mappings of the lengths chosen fail, returning the function
+// which restores them.
+func failMmap(fails func(length int) bool) func() {
+	mapFile := mmap
+	mmap = func(fd int, offset int64, length int, prot int, flags int) ([]byte, error) {
+		if fails(length) {
+			return nil, syscall.ENOMEM
+		}
+		return mapFile(fd, offset, length, prot, flags)
+	}
+	return func() { mmap = mapFile }
+}
@@ -0,0 +1,87 @@
+package readcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+func (c *readcache) GetMulti(keys []string) (map[string]interface{}, error) {
+	return getMulti(c, settings(c), keys, nil)
+}
+
+func (c *readcache) GetMultiContext(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	return getMulti(c, settings(c), keys, ctx)
+}
+
+// Get the items for several keys, fetching the missing items concurrently.
+// If a context is given, waiting for the fetches stops once it is done, and
+// the fetches started by this call are canceled.
+func getMulti(c *readcache, cfg *Config, keys []string, ctx context.Context) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(keys))
+	var errs []error
+	misses := make(map[string]*readControl)
+	started := make(map[string]bool)
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if _, ok := misses[key]; ok {
+			continue
+		}
+		cachedValue, control, start, err := getOrStartReadControl(c, cfg, key)
+		if err != nil {
+			errs = append(errs, err)
+		} else if control != nil {
+			misses[key] = control
+			started[key] = start
+		} else {
+			values[key] = cachedValue.Value
+		}
+	}
+
+	// Each miss is fetched through its key's read control, so a key missing
+	// from several concurrent calls is fetched only once among them.
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	cancelled := false
+	for key, control := range misses {
+		wait.Add(1)
+		go func(key string, control *readControl) {
+			defer wait.Done()
+			var cachedValue *cacheable
+			var err error
+			if ctx == nil {
+				cachedValue, err = doFetch(c, cfg, key, control, nil, 0)
+			} else {
+				stop := func() bool { return false }
+				if started[key] {
+					stop = context.AfterFunc(ctx, func() { cancelFetch(c, key, control) })
+				}
+				go func() {
+					doFetch(c, cfg, key, control, nil, 0)
+					stop()
+				}()
+				cachedValue, err = awaitFetch(control, time.Time{}, ctx)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			if ctx != nil && err != nil && err == ctx.Err() {
+				cancelled = true
+				return
+			}
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			values[key] = cachedValue.Value
+		}(key, control)
+	}
+	wait.Wait()
+
+	if cancelled {
+		return values, ctx.Err()
+	}
+	return values, errors.Join(errs...)
+}
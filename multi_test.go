@@ -0,0 +1,162 @@
+package readcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetMulti_ConcurrentOverlappingMisses_ShouldFetchEachKeyOnce(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount[key]++
+		fetchLock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	batches := [][]string{{"a", "b", "c"}, {"b", "c", "d"}}
+	results := make([]map[string]interface{}, len(batches))
+	var wait sync.WaitGroup
+	for i, batch := range batches {
+		wait.Add(1)
+		go func(i int, batch []string) {
+			defer wait.Done()
+			values, err := cache.GetMulti(batch)
+			if err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+			results[i] = values
+		}(i, batch)
+	}
+	wait.Wait()
+
+	for key, count := range fetchCount {
+		if count != 1 {
+			t.Errorf("Expected %s to be fetched once but got %d", key, count)
+		}
+	}
+	if len(fetchCount) != 4 {
+		t.Errorf("Expected 4 keys to be fetched but got %d", len(fetchCount))
+	}
+	for i, batch := range batches {
+		for _, key := range batch {
+			if results[i][key] != key {
+				t.Errorf("Expected %s in batch %d but got %v", key, i, results[i][key])
+			}
+		}
+	}
+}
+
+func TestGetMulti_ErrorInGetter_ShouldReturnOtherValues(t *testing.T) {
+	failure := errors.New("Error message")
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "bad" {
+			return nil, time.Now(), failure
+		}
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Set("cached", "cached", time.Now().Add(100e9))
+
+	values, err := cache.GetMulti([]string{"good", "bad", "cached"})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the getter's error but got %v", err)
+	}
+	if len(values) != 2 || values["good"] != "good" || values["cached"] != "cached" {
+		t.Errorf("Expected the good and cached values but got %v", values)
+	}
+}
+
+func TestGetMultiContext_CancelledMidBatch_ShouldReturnPartialResults(t *testing.T) {
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "slow" {
+			<-unblock
+		}
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Set("cached", "cached", time.Now().Add(100e9))
+	ctx, cancel := context.WithCancel(context.Background())
+	c := cache.(*readcache)
+	go func() {
+		for fetching := true; fetching; {
+			time.Sleep(time.Millisecond)
+			c.ReadControlsLock.RLock()
+			_, fetching = c.ReadControls["fast"]
+			c.ReadControlsLock.RUnlock()
+			fetching = fetching || cache.Status("fast") != StatusFresh
+		}
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	values, err := cache.GetMultiContext(ctx, []string{"cached", "fast", "slow"})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	if len(values) != 2 || values["cached"] != "cached" || values["fast"] != "fast" {
+		t.Errorf("Expected the cached and fast values but got %v", values)
+	}
+
+	close(unblock)
+	if result, err := cache.Get("slow"); result != "slow" || err != nil {
+		t.Errorf("Expected a later Get to fetch the item, but got %v, %v", result, err)
+	}
+}
+
+func TestGetMultiContext_Cancelled_ShouldCancelOnlyFetchesItStarted(t *testing.T) {
+	unblock := make(chan struct{})
+	fetching := make(chan string, 2)
+	canceled := make(chan string, 2)
+	getter := func(ctx context.Context, key string) (interface{}, time.Time, error) {
+		fetching <- key
+		select {
+		case <-ctx.Done():
+			canceled <- key
+			return nil, time.Time{}, ctx.Err()
+		case <-unblock:
+			return key, time.Now().Add(100e9), nil
+		}
+	}
+	cache := NewWithContext(getter)
+	joined := make(chan GetResult, 1)
+	go func() {
+		value, err := cache.Get("joined")
+		joined <- GetResult{Value: value, Err: err}
+	}()
+	<-fetching
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fetching
+		cancel()
+	}()
+	if _, err := cache.GetMultiContext(ctx, []string{"joined", "started"}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	select {
+	case key := <-canceled:
+		if key != "started" {
+			t.Errorf("Expected only the fetch of started to be canceled but got %v", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the fetch of started to be canceled")
+	}
+
+	close(unblock)
+	if result := <-joined; result.Value != "joined" || result.Err != nil {
+		t.Errorf("Expected the joined fetch to complete, but got %+v", result)
+	}
+	select {
+	case key := <-canceled:
+		t.Errorf("Unexpected cancellation of the fetch of %v", key)
+	default:
+	}
+}
@@ -0,0 +1,102 @@
+package readcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotCached is returned by GetWithOptions with WithNoFetch when the item is neither
+// cached nor being fetched.
+var ErrNotCached = errors.New("readcache: item is not cached")
+
+// GetOption tunes a single call to GetWithOptions.
+type GetOption func(*getOptions)
+
+// Type getOptions holds the options of a call to GetWithOptions
+type getOptions struct {
+	Deadline   time.Time
+	Context    context.Context
+	AllowStale bool
+	NoFetch    bool
+}
+
+// WithTimeout gives up waiting for the item after the given duration, and
+// returns ErrTimeout instead.  As with GetBefore, the fetch itself carries on.
+func WithTimeout(timeout time.Duration) GetOption {
+	return func(o *getOptions) { o.Deadline = time.Now().Add(timeout) }
+}
+
+// WithContext gives up waiting for the item once the context is done, and
+// returns the context's error instead.  The fetch itself carries on.
+func WithContext(ctx context.Context) GetOption {
+	return func(o *getOptions) { o.Context = ctx }
+}
+
+// WithAllowStale returns an expired item if the cache still holds one,
+// refreshing it in the background rather than waiting for a fetch.
+func WithAllowStale() GetOption {
+	return func(o *getOptions) { o.AllowStale = true }
+}
+
+// WithNoFetch never starts a fetch, as GetNoFetch does, returning
+// ErrNotCached if the item is neither cached nor being fetched.  Combined with
+// WithAllowStale, an expired item is returned without being refreshed.
+func WithNoFetch() GetOption {
+	return func(o *getOptions) { o.NoFetch = true }
+}
+
+// Get an item from the cache as tuned by the given options.
+func getWithOptions(c *readcache, cfg *Config, key string, opts []GetOption) (*cacheable, error) {
+	var o getOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := checkKey(cfg, key); err != nil {
+		return nil, err
+	}
+
+	if o.AllowStale {
+		c.CacheLock.RLock()
+		cachedValue, ok := c.Cache[key]
+		c.CacheLock.RUnlock()
+		if now := cfg.Clock.Now(); ok && !expiryTime(c, cfg, cachedValue, now).After(now) && !invalidate(c, cfg, key, cachedValue) {
+			countHit(c, true)
+			notifyHit(c, cfg, key)
+			if !o.NoFetch {
+				refresh(c, cfg, key)
+			}
+			return decodeItem(cachedValue)
+		}
+	}
+
+	if o.NoFetch {
+		if cachedValue, ok, stale := getFromCache(c, cfg, key); ok {
+			countHit(c, stale)
+			notifyHit(c, cfg, key)
+			return decodeItem(cachedValue)
+		}
+		notifyMiss(c, cfg, key)
+		c.ReadControlsLock.RLock()
+		readControl, ok := c.ReadControls[key]
+		c.ReadControlsLock.RUnlock()
+		if !ok {
+			return nil, ErrNotCached
+		}
+		cachedValue, err := awaitFetch(readControl, o.Deadline, o.Context)
+		if err == nil && cachedValue == nil {
+			return nil, ErrNotCached
+		}
+		return cachedValue, err
+	}
+
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	if readControl == nil {
+		return cachedValue, err
+	}
+	if o.Deadline.IsZero() && o.Context == nil {
+		return doFetch(c, cfg, key, readControl, nil, 0)
+	}
+	go doFetch(c, cfg, key, readControl, nil, 0)
+	return awaitFetch(readControl, o.Deadline, o.Context)
+}
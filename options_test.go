@@ -0,0 +1,105 @@
+package readcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetWithOptions_WithTimeout_SlowFetch_ShouldReturnErrTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	if _, err := cache.GetWithOptions("key", WithTimeout(10*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout but got %v", err)
+	}
+}
+
+func TestGetWithOptions_WithContext_Cancelled_ShouldReturnContextError(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := cache.GetWithOptions("key", WithContext(ctx)); err != context.Canceled {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+}
+
+func TestGetWithOptions_WithAllowStale_ExpiredItem_ShouldReturnItAndRefresh(t *testing.T) {
+	refreshed := make(chan interface{}, 1)
+	cache := New(newGetter("fresh", 100e9))
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshed <- newValue
+	})
+	cache.Set("key", "stale", time.Now().Add(-time.Second))
+
+	if result, err := cache.GetWithOptions("key", WithAllowStale()); result != "stale" || err != nil {
+		t.Errorf("Expected 'stale' but got %v, %v", result, err)
+	}
+	if value := <-refreshed; value != "fresh" {
+		t.Errorf("Expected a refresh to 'fresh' but got %v", value)
+	}
+	if result, _ := cache.GetWithOptions("key", WithAllowStale()); result != "fresh" {
+		t.Errorf("Expected 'fresh' but got %v", result)
+	}
+}
+
+func TestGetWithOptions_WithNoFetch_AbsentItem_ShouldReturnErrNotCached(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	if _, err := cache.GetWithOptions("key", WithNoFetch()); err != ErrNotCached {
+		t.Errorf("Expected ErrNotCached but got %v", err)
+	}
+	if fetchCount != 0 {
+		t.Errorf("Expected the getter not to be called, but got %d", fetchCount)
+	}
+}
+
+func TestGetWithOptions_WithAllowStale_WithNoFetch_ShouldReturnExpiredItemWithoutFetching(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "fresh", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Set("key", "stale", time.Now().Add(-time.Second))
+
+	if result, err := cache.GetWithOptions("key", WithAllowStale(), WithNoFetch()); result != "stale" || err != nil {
+		t.Errorf("Expected 'stale' but got %v, %v", result, err)
+	}
+	if fetchCount != 0 {
+		t.Errorf("Expected the getter not to be called, but got %d", fetchCount)
+	}
+}
+
+func TestGetWithOptions_WithNoFetch_WithTimeout_SlowFetchUnderway_ShouldReturnErrTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	go cache.Get("key")
+	waitForReadControl(t, cache, "key")
+
+	if _, err := cache.GetWithOptions("key", WithNoFetch(), WithTimeout(10*time.Millisecond)); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout but got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package readcache
+
+import (
+	"cmp"
+	"container/list"
+	"slices"
+	"sync/atomic"
+)
+
+// Policy decides which items are purged first when the cache grows to its
+// configured size.  Within each priority tier, items are purged in the
+// policy's order, and pinned items are passed over whatever the policy.
+type Policy int
+
+const (
+	// Items are purged in the order they were stored, oldest first.
+	PolicyFIFO Policy = iota
+
+	// Items are purged in the order they were last stored or found in the
+	// cache, least recent first.
+	PolicyLRU
+
+	// Items are purged in the order of how often they have been stored or
+	// found in the cache, least often first, and least recent first among
+	// equals.  Storing an item counts as a use of it.
+	PolicyLFU
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyFIFO:
+		return "fifo"
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	}
+	return "unknown"
+}
+
+// Type itemUse records how recently and how often an item has been used, for
+// the LRU and LFU policies.  Shared by the copies of an item, and by the items
+// stored in turn for a key.
+type itemUse struct {
+	// The use clock's reading at the item's most recent use
+	Last atomic.Uint64
+
+	// The number of uses of the item
+	Count atomic.Uint64
+}
+
+func (c *readcache) EvictionPolicy() Policy {
+	return settings(c).EvictionPolicy
+}
+
+func (c *readcache) SetEvictionPolicy(policy Policy) {
+	configure(c, func(cfg *Config) { cfg.EvictionPolicy = policy })
+	migratePolicy(c)
+}
+
+// Record a use of an item, if the eviction policy keeps track of uses.
+func recordUse(c *readcache, cfg *Config, item *cacheable) {
+	if cfg.EvictionPolicy == PolicyFIFO || item.Use == nil {
+		return
+	}
+	item.Use.Last.Store(c.UseClock.Add(1))
+	item.Use.Count.Add(1)
+}
+
+// Give the items which have no record of their uses one, so that they can be
+// ordered by the current eviction policy.  The items are seeded in the order
+// they were stored, each as used once, or as often as it has been found in
+// the cache if access tracking was enabled.
+func migratePolicy(c *readcache) {
+	if settings(c).EvictionPolicy == PolicyFIFO {
+		return
+	}
+	c.CacheLock.Lock()
+	defer c.CacheLock.Unlock()
+	for element := c.Additions.Back(); element != nil; element = element.Prev() {
+		key := element.Value.(string)
+		item, ok := c.Cache[key]
+		if !ok || item.Use != nil {
+			continue
+		}
+		seeded := *item
+		seeded.Use = new(itemUse)
+		seeded.Use.Last.Store(c.UseClock.Add(1))
+		seeded.Use.Count.Store(1)
+		if item.Accesses != nil {
+			seeded.Use.Count.Add(item.Accesses.Load())
+		}
+		c.Cache[key] = &seeded
+	}
+}
+
+// List the recorded additions in the order the current eviction policy would
+// purge them.  Under LRU and LFU, the addition just made, at the front, is
+// left out, so that an item is never purged to make room for itself.  The
+// caller must hold CacheLock.
+func purgeOrder(c *readcache, cfg *Config) []*list.Element {
+	order := make([]*list.Element, 0, c.AdditionCount)
+	for element := c.Additions.Back(); element != nil; element = element.Prev() {
+		order = append(order, element)
+	}
+	if cfg.EvictionPolicy == PolicyFIFO || len(order) == 0 {
+		return order
+	}
+
+	order = order[:len(order)-1]
+	use := func(element *list.Element) (last, count uint64) {
+		if item, ok := c.Cache[element.Value.(string)]; ok && item.Use != nil {
+			return item.Use.Last.Load(), item.Use.Count.Load()
+		}
+		return 0, 0
+	}
+	slices.SortStableFunc(order, func(a, b *list.Element) int {
+		aLast, aCount := use(a)
+		bLast, bCount := use(b)
+		if cfg.EvictionPolicy == PolicyLFU && aCount != bCount {
+			return cmp.Compare(aCount, bCount)
+		}
+		return cmp.Compare(aLast, bLast)
+	})
+	return order
+}
@@ -0,0 +1,78 @@
+package readcache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func newPolicyCache() (CacheWithSettings, *[]string) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return key, time.Now().Add(100e9), nil
+	}
+	var purged []string
+	cache := New(getter)
+	cache.SetPurgeAt(4)
+	cache.SetPurgeTo(3)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		if reason == EvictionCapacity {
+			purged = append(purged, key)
+		}
+	})
+	return cache, &purged
+}
+
+func TestSetEvictionPolicy_SwitchFromLRUToLFU_ShouldPurgeByNewPolicy(t *testing.T) {
+	cache, purged := newPolicyCache()
+	cache.SetEvictionPolicy(PolicyLRU)
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("c")
+	cache.Get("a")
+	cache.Get("d")
+	if !slices.Equal(*purged, []string{"b"}) {
+		t.Errorf("Expected the least recently used b to be purged but got %v", *purged)
+	}
+
+	cache.SetEvictionPolicy(PolicyLFU)
+	if policy := cache.EvictionPolicy(); policy != PolicyLFU {
+		t.Errorf("Expected the LFU policy but got %v", policy)
+	}
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("c")
+	cache.Get("d")
+	cache.Get("e")
+	if !slices.Equal(*purged, []string{"b", "c"}) {
+		t.Errorf("Expected the least frequently used c to be purged next but got %v", *purged)
+	}
+}
+
+func TestSetEvictionPolicy_SwitchFromFIFOToLRU_ShouldSeedInStoredOrder(t *testing.T) {
+	cache, purged := newPolicyCache()
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("c")
+
+	cache.SetEvictionPolicy(PolicyLRU)
+	cache.Get("a")
+	cache.Get("d")
+	if !slices.Equal(*purged, []string{"b"}) {
+		t.Errorf("Expected the least recently used b to be purged but got %v", *purged)
+	}
+}
+
+func TestGet_WithDefaultPolicy_ShouldPurgeInStoredOrder(t *testing.T) {
+	cache, purged := newPolicyCache()
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("c")
+	cache.Get("a")
+	cache.Get("d")
+	if policy := cache.EvictionPolicy(); policy != PolicyFIFO {
+		t.Errorf("Expected the FIFO policy but got %v", policy)
+	}
+	if !slices.Equal(*purged, []string{"a"}) {
+		t.Errorf("Expected the oldest a to be purged but got %v", *purged)
+	}
+}
@@ -7,15 +7,26 @@ package readcache
 
 import (
 	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"weak"
 )
 
 // Cache defines a read-through cache.
 type Cache interface {
 	// Retrieve an item from the cache if available, or from a
 	// backing source if it is not.
-	// May return an error instead, if the item cannot be fetched.
+	// May return an error instead, if the item cannot be fetched.  An error
+	// returned by the item fetcher is wrapped in a FetchError.
 	Get(key string) (interface{}, error)
 }
 
@@ -23,206 +34,2702 @@ type Cache interface {
 type CacheWithSettings interface {
 	Cache
 
+	// Retrieve an item as Get does, with options tuning the call; see
+	// GetOption.  Without options, it behaves exactly as Get.
+	GetWithOptions(key string, opts ...GetOption) (interface{}, error)
+
+	// Retrieve an item as Get does, along with its version.  Each time an item
+	// is fetched or set it is given a new, larger version, so two calls which
+	// return the same version have observed the same value.
+	GetVersioned(key string) (value interface{}, version uint64, err error)
+
+	// Retrieve an item as Get does, along with where it came from.  The source
+	// is meaningful only when no error is returned.
+	GetSourced(key string) (value interface{}, source Source, err error)
+
+	// Retrieve an item as Get does, but give up waiting for the fetch at the
+	// given deadline and return ErrTimeout instead.  The fetch itself carries
+	// on, so that the item is cached for later callers.
+	GetBefore(key string, deadline time.Time) (interface{}, error)
+
+	// Retrieve an item as Get does, but with the given priority for its fetch.
+	// When the configured number of concurrent fetches is reached, waiting
+	// fetches are started in order of priority, highest first.  Get fetches
+	// with priority zero.
+	GetWithPriority(key string, priority int) (interface{}, error)
+
+	// Retrieve an item as Get does, but if the item is fetched, cache it until
+	// the given duration from now, in place of the expiration time given by
+	// the fetcher or any TTL override.  A cached item is returned as it is.
+	// Concurrent calls for a key share a single fetch, so when callers pass
+	// different durations, the duration of the caller which started the fetch
+	// wins.
+	GetWithTTL(key string, ttl time.Duration) (interface{}, error)
+
+	// Retrieve an item by fetching it, even if it is cached, and cache the
+	// fetched item for later callers, as for a forced refresh.  If the item is
+	// already being fetched, that fetch is shared rather than another started.
+	// Remembered fetch errors are not consulted.
+	GetForceRefresh(key string) (interface{}, error)
+
+	// Retrieve an item as Get does, but with the item's storage and any
+	// shared fetch scoped to the given group, so that the same key in two
+	// groups names two independent items.  The item fetcher is given the key
+	// alone.  The item is held under GroupKey(group, key), which is the key
+	// seen by settings and callbacks which are given keys.
+	GetInGroup(group, key string) (interface{}, error)
+
+	// Retrieve an item as Get does, along with a breakdown of where the call
+	// spent its time.  Only this method is instrumented, so Get pays nothing
+	// for it.
+	GetTimed(key string) (value interface{}, timing GetTiming, err error)
+
+	// Retrieve an item from the cache without ever fetching it.  If the item
+	// is not cached but another caller is fetching it, waits for that fetch.
+	// Otherwise, reports that the item was not found.
+	GetNoFetch(key string) (value interface{}, found bool, err error)
+
+	// Retrieve an item as Get does, but if the item fetcher reports that
+	// there is no item, with ErrNotFound, return the given default value
+	// rather than the error.  Any other error is returned as it is.
+	GetOrDefaultOnNotFound(key string, def interface{}) (value interface{}, err error)
+
+	// Retrieve an item as Get does, along with the ETag of its value.  The
+	// ETag is computed once, when the item is fetched or set, by the
+	// configured ETag function; it is empty if there is none.
+	GetWithETag(key string) (value interface{}, etag string, err error)
+
+	// Retrieve an item as Get does, along with its origin: the node which
+	// fetched or set it, and when.  An item loaded from an L2 store keeps the
+	// origin the store gives it if the store implements OriginL2; otherwise
+	// its origin is unknown, and given as the zero Origin.
+	GetWithOrigin(key string) (value interface{}, origin Origin, err error)
+
+	// Start retrieving an item as Get does, returning a channel to which the
+	// outcome is sent once it is ready, after which the channel is closed.
+	// Calls for the same key share a fetch as Gets do.  The channel is
+	// buffered, so a caller which never reads from it does not hold anything
+	// up.
+	GetAsync(key string) <-chan GetResult
+
+	// Retrieve the items for several keys as Get does, fetching the missing
+	// items concurrently.  A key missing from several concurrent calls, or
+	// being fetched by Get, is fetched only once among them.  Returns the
+	// items which could be retrieved, with the errors of any which could not
+	// joined together.
+	GetMulti(keys []string) (map[string]interface{}, error)
+
+	// Retrieve the items for several keys as GetMulti does, but stop waiting
+	// for the missing items once the context is done, returning the items
+	// retrieved by then along with the context's error.  The fetches this
+	// call started are canceled, as by DeleteAndCancel, through the context
+	// given to a context-aware item fetcher; see SetContextGetter.  Fetches
+	// already underway when the call joined them carry on, so that they are
+	// not cut short for the callers which started them.
+	GetMultiContext(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+	// Retrieve an item from the cache if available, or compute it with the
+	// given function if it is not.  Concurrent calls for the same key, including
+	// calls to Get, share a single computation.  This does not require the
+	// cache to have a fetcher, so it may be used with NewLazy.
+	Compute(key string, fn func() (interface{}, time.Time, error)) (interface{}, error)
+
+	// Store an item in the cache, replacing any existing item for the key.
+	// Returns ErrKeyTooLong if the key is longer than the configured maximum.
+	Set(key string, value interface{}, expiresAt time.Time) error
+
+	// Store an item in the cache only if the version of the existing item for
+	// the key matches the expected version, where zero matches an absent item.
+	// Returns true if the item was stored.  An item whose key is longer than the
+	// configured maximum is never stored.
+	SetIfVersion(key string, value interface{}, expiresAt time.Time, expectedVersion uint64) bool
+
+	// Store an item in the cache only if the cache already holds an item for
+	// the key, even an expired one.  Returns true if the item was stored.
+	Replace(key string, value interface{}, expiresAt time.Time) bool
+
+	// Store an item in the cache only if the cache holds no item for the key,
+	// not even an expired one, and the item is not being fetched.  Returns
+	// true if the item was stored.  An item whose key is longer than the
+	// configured maximum is never stored.
+	Add(key string, value interface{}, expiresAt time.Time) bool
+
+	// Fetch the items for the given keys, using at most the given number of
+	// concurrent fetches, so that the cache is populated ahead of demand.
+	// Keys which are already cached are not fetched again.  Returns once every
+	// fetch has completed, with the errors of any which failed joined together.
+	Warm(keys []string, concurrency int) error
+
+	// Fetch, in the background, the items for keys received from the channel,
+	// using at most the given number of concurrent fetches, until the channel
+	// is closed or StopWarming is called.  Keys which are already cached are
+	// not fetched again, and fetches are shared with other callers and count
+	// towards the in-flight limit as Get's do.  Returns at once.
+	WarmFromChannel(keys <-chan string, concurrency int)
+
+	// Stop every warming started by WarmFromChannel.  Fetches already started
+	// complete, but no further keys are received.
+	StopWarming()
+
+	// Refresh, in the background, every item which expires within the given
+	// duration, including expired items still held, using at most the given
+	// number of concurrent fetches.  Items already being fetched are not
+	// fetched again.  Each refresh is reported to the OnRefresh function.
+	// Returns the number of items scheduled for refresh.
+	RefreshExpiring(within time.Duration, concurrency int) int
+
+	// Retrieve an item as Get does, along with a channel to which each value
+	// later fetched and cached for the key is sent, whether by a background
+	// refresh or once the item has expired, until the returned cancel function
+	// is called, which closes the channel.  Items stored by Set are not sent.
+	// The channel holds only the latest value, so a slow receiver misses
+	// intermediate values rather than holding up fetches.  If the item cannot
+	// be retrieved, its error is returned and nothing is watched.
+	Watch(key string) (value interface{}, updates <-chan interface{}, cancel func(), err error)
+
+	// Report whether the cache holds an item for a key and whether it has
+	// expired, without fetching the item or removing an expired one.
+	Status(key string) KeyStatus
+
+	// Report how long remains until the item for a key expires, by the
+	// cache's clock, without fetching the item or removing an expired one.
+	// False is reported if there is no item or it has expired, in which case
+	// the duration is zero or how long ago it expired, respectively.
+	Remaining(key string) (time.Duration, bool)
+
+	// List the keys which are being fetched, with when each fetch was
+	// requested, earliest first, so that stuck fetches can be spotted.  A fetch
+	// counts from when it was requested, including any wait for a fetch slot.
+	InFlight() []InFlightFetch
+
+	// Report statistics about the current contents of the cache, and about
+	// how it has been used.
+	Stats() CacheStats
+
+	// Report statistics as Stats does, but with the counts of how the cache
+	// has been used, such as Hits, given as the difference since the last
+	// call to StatsDelta, or since the cache was constructed for the first
+	// call.  Figures describing the current contents, such as Entries, are
+	// reported as they are.  The baseline is shared by every caller.
+	StatsDelta() CacheStats
+
+	// Start reporting the cache's statistics, as Stats does, to a function
+	// at the given interval, from a goroutine of its own.  The interval is
+	// measured by the cache's clock when reporting starts; see Clock.  A
+	// report which takes longer than the interval delays the next, rather
+	// than piling up.  Returns the function which stops the reporting; a
+	// report in progress is completed, but no other is started.  Each call
+	// starts a reporter of its own.  An interval of zero or less reports
+	// nothing.
+	SetStatsReporter(interval time.Duration, report func(CacheStats)) (stop func())
+
+	// Report the keys of the n cached items which Get has found in the cache
+	// most often, most often first, with the number of times each was found.
+	// Only accesses made while key access tracking is enabled are counted,
+	// and an item's count starts afresh each time the item is replaced.
+	TopKeys(n int) []KeyCount
+
+	// Remove the item for a key from the cache, along with the items for every
+	// key which depends on it, directly or transitively.
+	Delete(key string)
+
+	// Remove the item for a key as Delete does, and cancel any fetch of the
+	// key which is in flight, so that its result does not repopulate the
+	// item.  The context given to a context-aware item fetcher is canceled;
+	// callers waiting on the fetch get whatever the fetcher returns, but the
+	// result is not cached, nor is an error remembered.  A later Get starts a
+	// fresh fetch.  Fetches of the dependent keys are not canceled.
+	DeleteAndCancel(key string)
+
+	// Start removing the items for the keys received from a channel, along
+	// with the items which depend on them, as invalidations published by
+	// other caches; see SetInvalidationPublisher.  The items are removed from
+	// this cache alone: the L2 store is left alone, and the removals are not
+	// published in turn.  Listening stops once the channel is closed.
+	StartInvalidationListener(keys <-chan string)
+
+	// Store an item in the cache as Set does, returning the item it replaced,
+	// even an expired one, and whether there was one.  Nothing is stored if
+	// the key is longer than the configured maximum.
+	GetAndSet(key string, value interface{}, expiresAt time.Time) (prev interface{}, hadPrev bool)
+
+	// Remove items from the cache as Delete does, returning the removed item
+	// for the key itself, even an expired one, and whether there was one.
+	GetAndDelete(key string) (prev interface{}, hadPrev bool)
+
+	// Record that the item for one key is derived from the item for another,
+	// so that deleting the latter also deletes the former.  Cycles are allowed.
+	// The dependency is forgotten once either item is deleted, or the item
+	// for the dependent key is purged.
+	AddDependency(dependent string, dependsOn string)
+
+	// Remove every expired item from the cache, returning the removed items.
+	DrainExpired() []ExpiredEntry
+
+	// Expire every item in the cache at once, without visiting them, by
+	// starting a new generation.  Items stored before the new generation are
+	// treated as having expired at the zero time, so they are fetched again
+	// rather than served stale.
+	BumpGeneration()
+
+	// Copy every unexpired item in the cache into a map, which the caller may
+	// use without holding up the cache.  The values themselves are shared, not
+	// copied, but the map holds an entry for every item, so for a large cache
+	// it costs memory in proportion to the number of items.
+	Snapshot() map[string]SnapshotEntry
+
+	// List the keys of the unexpired items in the cache which match a regular
+	// expression, in sorted order, or return the error compiling it.  The
+	// expression is matched anywhere in a key unless it is anchored.
+	KeysMatching(pattern string) ([]string, error)
+
+	// Report the most recent values stored for a key, whether fetched or set,
+	// oldest first and ending with the current one, with when each was stored.
+	// At most the configured history depth of values are kept, and only while
+	// the key is cached: values replaced by a refresh or by Set are kept, but
+	// an item which is deleted, purged or removed once expired takes its
+	// history with it.
+	History(key string) []HistoricalValue
+
+	// Iterate over the items in the cache without holding it locked
+	// throughout.  The keys are listed when the iterator is created, and each
+	// item is looked up as the iterator reaches it, so an item replaced
+	// meanwhile is seen as it is then, an item removed or expired meanwhile is
+	// skipped, and an item added meanwhile is not visited.  Each key is
+	// visited at most once.
+	Iterator() *CacheIterator
+
+	// Write every unexpired item in the cache to a stream in gob format, with
+	// its expiration time, such as to hand the cache over to a standby.  Each
+	// item's value is encoded as an interface value, so every type of value
+	// must be registered with gob.Register, or an error is returned.
+	WriteGob(w io.Writer) error
+
+	// Read items written by WriteGob from a stream and store them as Set
+	// does, skipping those which have expired since.  The value types must be
+	// registered with gob here too.  Items read before an error are kept.
+	ReadGob(r io.Reader) error
+
+	// Exempt the item for a key from being purged when the cache grows to its
+	// configured size.  The item still expires normally.  A key may be pinned
+	// before its item is cached.
+	Pin(key string)
+
+	// Remove the purge exemption for a key.
+	Unpin(key string)
+
+	// Check the consistency of the cache's internal state, returning every
+	// problem found joined together, or nil if there are none.  This is
+	// meant for debugging, and locks the whole cache while it runs.  A key
+	// may legitimately be both cached and being fetched, as when it is set
+	// mid-fetch, so that is not reported.
+	Validate() error
+
+	// Report the current settings.
+	Config() Config
+
+	// Replace all of the settings at once, so that no operation observes a
+	// mix of old and new settings.  Operations which are already underway,
+	// including in-flight fetches, complete with the settings they started
+	// with.  Since a zero Config disables every setting, including those with
+	// a non-zero default, start from the settings reported by Config.
+	Reconfigure(cfg Config)
+
 	// Configure the cache size at which the cache will be purged
 	SetPurgeAt(purgeAt int)
 
-	// Configure the resulting size of the cache after a purge.
-	// This value should be smaller than the configured value for PurgeAt
-	SetPurgeTo(purgeTo int)
+	// Configure the resulting size of the cache after a purge.
+	// This value should be smaller than the configured value for PurgeAt
+	SetPurgeTo(purgeTo int)
+
+	// Configure the number of items purged at a time while the cache is
+	// locked.  Between chunks the lock is released, so that Gets of cached
+	// items are not held up for the whole of a large purge; each chunk
+	// decides afresh which items to purge, taking the changes made
+	// meanwhile into account.  Zero, the default, purges in one go.
+	SetEvictionChunkSize(n int)
+
+	// Report the policy which decides which items are purged first.
+	EvictionPolicy() Policy
+
+	// Configure the policy which decides which items are purged first, on a
+	// live cache.  LRU and LFU keep a record of each item's uses, costing an
+	// atomic update of a shared counter on each hit, and sort the items on
+	// each purge.  Switching to either walks every item with the cache
+	// locked, so that Gets and Sets wait, to seed the record of any item
+	// without one in the order the items were stored.  Switching to FIFO is
+	// free, since the order items were stored in is always kept.  PolicyFIFO
+	// is the default.
+	SetEvictionPolicy(policy Policy)
+
+	// Configure the item fetcher, replacing any fetcher given at construction.
+	SetGetter(getter func(string) (interface{}, time.Time, error))
+
+	// Configure an item fetcher which is given a context, replacing any
+	// fetcher given at construction; see NewWithContext.
+	SetContextGetter(getter func(ctx context.Context, key string) (interface{}, time.Time, error))
+
+	// Configure an item fetcher which may return, along with the item for its
+	// key, further items for other keys, replacing any fetcher given at
+	// construction; see NewFanOut.
+	SetFanOutGetter(getter func(string) (interface{}, time.Time, map[string]ValueWithExpiry, error))
+
+	// Configure a logger for cache activity.  Hits, misses, fetches and
+	// evictions are logged at debug level, and fetch errors at warn level.
+	// A nil logger, the default, disables logging.
+	SetLogger(logger *slog.Logger)
+
+	// Configure a function which computes the time to live of an item from
+	// how long it took to fetch.  It is used only when the item fetcher returns
+	// a zero expiration time, so that expensive items can be kept for longer.
+	SetCostBasedTTL(ttl func(fetchDuration time.Duration) time.Duration)
+
+	// Configure a function which computes the expiration time of each fetched
+	// item from its key, its value and the expiration time given by the fetcher
+	// (or computed by SetCostBasedTTL).  Returning the given expiration time
+	// leaves it unchanged.
+	SetTTLOverride(override func(key string, value interface{}, getterExpiry time.Time) time.Time)
+
+	// Configure a minimum time for which each fetched item is kept, however
+	// soon it is due to expire, so that a burst of callers arriving just after
+	// a fetch completes share its result rather than each fetching again.  It
+	// applies after any TTL override, and to fetched items only.  Zero, the
+	// default, keeps items only until they expire.
+	SetMinResultReuse(d time.Duration)
+
+	// Configure a function to be called whenever an item is removed from the
+	// cache.  It is called after the cache's locks have been released.
+	SetOnEvict(onEvict func(key string, value interface{}, reason EvictionReason))
+
+	// Configure whether a nil item returned by the fetcher is stored in the
+	// cache.  When false, the nil item is returned to the caller but the next
+	// Get fetches again.  Defaults to true.
+	SetCacheNilValues(cacheNilValues bool)
+
+	// Configure a function which decides whether a value returned by the
+	// fetcher is stored in the cache.  When it returns false, the value is
+	// returned to the caller but the next Get fetches again, as for nil
+	// values which are not cached.  Nil, the default, stores every value.
+	SetCachePredicate(predicate func(key string, value interface{}) bool)
+
+	// Register an observer of cache activity.  Any number of observers may be
+	// registered, and each is called for every event in registration order.
+	// Any buffered events are replayed to the observer first; see
+	// SetEventBuffer.
+	AddObserver(observer Observer)
+
+	// Configure the number of recent events, of the kinds reported to
+	// observers, which the cache retains, so that they can be replayed in
+	// order to each observer as it is registered.  Events reported while an
+	// observer is being registered may be missed by it.  Zero, the default,
+	// retains no events.
+	SetEventBuffer(n int)
+
+	// Configure how long a fetch error is remembered.  While an error is
+	// remembered, Get for its key returns the error without fetching again.
+	// If the fetcher returns an expiration time in the future along with the
+	// error, the error is remembered until then instead; a zero or past
+	// expiration time uses the backoff.
+	// Errors are remembered for a bounded number of keys; see
+	// SetMaxNegativeEntries.  Zero, the default, disables the backoff.
+	SetErrorBackoff(backoff time.Duration)
+
+	// Configure the number of keys for which a fetch error is remembered.
+	// Errors are held apart from the cached items, and when there are too
+	// many the least recently failed key is forgotten, so a flood of failing
+	// keys never purges cached items.  Zero, the default, remembers errors
+	// for 1024 keys.
+	SetMaxNegativeEntries(n int)
+
+	// Configure a random spread for error backoffs, as a fraction of the
+	// backoff.  Each error is remembered for a duration chosen at random
+	// between the backoff shortened by that fraction and the full backoff, so
+	// that keys which failed together are retried at different times.  Zero,
+	// the default, remembers every error for the full backoff.
+	SetErrorBackoffJitter(jitter float64)
+
+	// Configure a circuit breaker for the item fetcher.  Once the given number
+	// of consecutive fetches have failed, the breaker opens for the cooldown:
+	// Get still serves cached items, including stale ones, but an item which
+	// must be fetched fails fast with ErrBackendUnavailable without calling
+	// the fetcher.  The fallback fetcher, if any, is still used.  After the
+	// cooldown, fetches are tried again; a success closes the breaker, while
+	// a failure opens it for another cooldown.  A fetch which reports its
+	// key absent with ErrNotFound counts as neither.  Failures made fast are
+	// not remembered by the error backoff.  Zero failures, the default,
+	// disables the breaker.
+	SetCircuitBreaker(failures int, cooldown time.Duration)
+
+	// Configure a function which supplies a value for an item which must be
+	// fetched while the circuit breaker is open, in place of failing with
+	// ErrBackendUnavailable.  If it reports that it has no value, the fetch
+	// fails fast as usual.  It is called in place of the fetcher, so it
+	// should be cheap.  Its values are returned with SourceFallback, and are
+	// not cached, so that the item is fetched once the breaker closes.  Nil,
+	// the default, supplies no values.
+	SetCircuitOpenFallback(fallback func(key string) (interface{}, bool))
+
+	// Configure a guard against lookups of keys which do not exist, such as a
+	// client scanning for keys, flooding the item fetcher.  The guard keeps a
+	// bloom filter of the keys known to be present, being those cached now
+	// or stored later, sized for the expected number of keys at the given
+	// false positive rate.  Once most of the recent fetches report their
+	// keys absent with ErrNotFound, the guard engages: a fetch of a key
+	// which is certainly not in the filter returns ErrNotFound without
+	// calling the fetcher.  The guard disengages once most of the fetches it
+	// lets through find their keys, so a key which exists but was never
+	// cached may be reported absent only while it does.  Reconfiguring the
+	// guard starts it afresh.  Zero expected keys, the default, disables the
+	// guard.
+	SetPenetrationGuard(expectedKeys int, falsePositiveRate float64)
+
+	// Configure a secondary store to consult before the item fetcher, and to
+	// write fetched and set items through to.  Nil, the default, disables it.
+	SetL2(l2 L2)
+
+	// Configure a store, typically disk-backed, to which items purged because
+	// the cache grew to its configured size are spilled rather than lost.  On
+	// a miss, the spill store is consulted before the L2 store and the item
+	// fetcher, and an unexpired item found there is moved back into the
+	// cache.  Storing or deleting an item removes any spilled copy.  Nil, the
+	// default, disables spilling.
+	SetSpillStore(store L2)
+
+	// Configure writes to the L2 store to be made behind, by a background
+	// worker, rather than by the goroutine which stored the item.  At most the
+	// given number of writes are queued; when the queue is full, further
+	// stores either wait for space, if block is true, or are dropped and
+	// counted in the stats.  Deletions always wait, so that the L2 store
+	// never goes on serving a deleted item.  Zero, the default, writes
+	// through directly.
+	SetWriteBehind(bufferSize int, block bool)
+
+	// Configure calls of the eviction callback to be made by the given number
+	// of background workers, rather than by the goroutine which removed the
+	// items, so that a slow callback does not hold up the cache.  The calls
+	// for a key are made in order by a single worker, as long as the number
+	// of workers is unchanged.  Each worker queues at most the given number
+	// of calls; when its queue is full, further calls either wait for space,
+	// if block is true, or are dropped and counted in the stats.  Zero
+	// workers, the default, calls the callback directly.
+	SetAsyncEvictCallbacks(workers int, queueSize int, block bool)
+
+	// Configure a codec with which items are serialized while they are held
+	// in the cache, and deserialized whenever they are read.  Items stored
+	// while a codec is configured keep being decoded with it.  An item which
+	// fails to encode is not cached, and an item which fails to decode is
+	// reported as an error but left in the cache.  Nil, the default, holds
+	// items as they are.
+	SetValueCodec(codec Codec)
+
+	// Configure the size in bytes up to which values are held as they are,
+	// rather than serialized by the value codec, so that small values, which
+	// gain little or even grow from compression, are not decoded on every
+	// hit.  Each value is still encoded once when stored, to measure it.
+	// Zero, the default, holds every value serialized.
+	SetCompressionThreshold(bytes int)
+
+	// Configure a function which measures the size of a value in bytes, for
+	// use by SetMaxEntryBytes.  Nil, the default, leaves values unmeasured.
+	SetSizer(sizer func(value interface{}) int64)
+
+	// Configure the largest fetched item to cache, in bytes as measured by the
+	// sizer.  A larger item is returned to its callers but not cached, so
+	// that one giant value cannot dominate memory; each is counted in
+	// CacheStats.  Zero, the default, or the lack of a sizer, caches items of
+	// any size.
+	SetMaxEntryBytes(limit int64)
+
+	// Configure an item fetcher to use when the primary item fetcher returns an
+	// error.  If the fallback also returns an error, the primary fetcher's
+	// error is returned.  Nil, the default, disables it.
+	SetFallbackGetter(getter func(string) (interface{}, time.Time, error))
+
+	// Configure how long to wait for the item fetcher before calling it a
+	// second time for the same key, with the fetch taking the result of
+	// whichever call returns first.  This trades extra load on the backing
+	// source for lower tail latency.  The slower call is not interrupted,
+	// but its result is ignored; a context-aware fetcher sees the fetch's
+	// context canceled once the fetch completes.  Each call holds a fetch
+	// slot until it returns, and the second call is skipped if no slot is
+	// free; see SetMaxConcurrentFetches.  Only the configured fetcher is
+	// hedged, not the functions given to Compute.  The delay is measured in
+	// real time.  Zero, the default, calls the fetcher once.
+	SetHedging(delay time.Duration)
+
+	// Configure the clock used to decide when items have expired.  Defaults
+	// to the real time.
+	SetClock(clock Clock)
+
+	// Configure a sliding expiration, so that each time Get finds an item in
+	// the cache, the item's expiration time is reset to the given duration
+	// from now.  Items which are not accessed expire as usual.  Because every
+	// hit updates the item, this takes a brief write lock on each hit.  Zero,
+	// the default, disables sliding expiration.
+	SetSlidingExpiration(ttl time.Duration)
+
+	// Configure a function which recomputes an item's expiration time each time
+	// Get finds the unexpired item in the cache, from its key, its value and
+	// its current expiration time (after any sliding expiration).  Returning
+	// the current expiration time leaves the item as it is; otherwise, as with
+	// sliding expiration, the hit takes a brief write lock to update it.  Nil,
+	// the default, leaves expiration times alone.
+	SetOnHitExpiry(onHit func(key string, value interface{}, currentExpiry time.Time) time.Time)
+
+	// Configure how many of the most recent values stored for each key are
+	// kept, for History.  The values are kept as they are, even if a value
+	// codec is configured.  Zero, the default, keeps no history.
+	SetHistoryDepth(k int)
+
+	// Configure the maximum length of a key.  Get and Set with a longer key
+	// return ErrKeyTooLong rather than caching anything.  Zero, the default,
+	// allows keys of any length.
+	SetMaxKeyLength(maxKeyLength int)
+
+	// Configure the maximum number of fetches which may run at once.  Further
+	// fetches wait, and are started in order of priority as running fetches
+	// complete.  Among equal priorities, waiting fetches are started
+	// round-robin across keys, so that a key fetched over and over cannot
+	// starve the others.  Zero, the default, allows any number of concurrent
+	// fetches.
+	SetMaxConcurrentFetches(maxConcurrentFetches int)
+
+	// Configure how long past its expiration time an item may still be served.
+	// Within that window, Get returns the expired item at once and refreshes it
+	// in the background, sharing the refresh with any other fetch of the key.
+	// Zero, the default, never serves expired items.
+	SetStaleWhileRevalidate(window time.Duration)
+
+	// Configure how many hits on an expired item it takes to refresh it.
+	// Expired items are served however long past their expiration time, and
+	// only every nth hit on each refreshes it in the background, as within
+	// the stale-while-revalidate window.  Items stored before sampling was
+	// configured are refreshed on every hit.  Zero or one, the default,
+	// serves expired items only within the stale-while-revalidate window,
+	// refreshing them on every hit.
+	SetRefetchSampling(n int)
+
+	// Configure a function which checks each item Get finds in the cache before
+	// it is served.  An item the function rejects is removed and fetched again,
+	// as if it had expired, so that items made invalid by something other than
+	// time can be dropped.  The function is called on every hit, so it must be
+	// cheap.  Nil, the default, serves every unexpired item.
+	SetValidator(validator func(key string, value interface{}) bool)
+
+	// Configure whether items whose values are pointers hold them weakly, so
+	// that the garbage collector may reclaim a value which nothing outside
+	// the cache refers to.  Get treats an item whose value was reclaimed as a
+	// miss, removing it and fetching it again.  Values which are not
+	// pointers, and values kept for History, are held as usual.  Items stored
+	// while this is false hold their values as usual.  False is the default.
+	SetWeakValues(weak bool)
+
+	// Configure the functions which hash and compare fetched values, so that
+	// keys whose values are equal share a single copy of the value.  A value
+	// fetched for a key which equals, by the second function, a value of the
+	// same type already cached for another key is replaced by the cached
+	// value, in the cache and in what the fetch returns.  Equal values must
+	// have equal hashes; only cached values with the same hash as the fetched
+	// one are compared with it, so that a fetch need not compare its value
+	// with every cached value of the type.  Values held encoded, and values
+	// stored by Set, are never shared.  Nil for either function, the default,
+	// shares no values.
+	SetInterning(hash func(value interface{}) string, equals func(a, b interface{}) bool)
+
+	// Configure the function which compares values given to Set, so that
+	// setting a key to a value equal to its current one, by this function,
+	// only changes the item's expiration time.  The item keeps its value and
+	// version, counts as neither used nor added for the eviction policy, and
+	// adds nothing to its history; no invalidation is published and nothing
+	// is written to the L2 store.  An item which has expired by a
+	// generation bump is replaced as usual.  Nil, the default, has every Set
+	// replace the item.
+	SetSuppressRedundantSet(equals func(a, b interface{}) bool)
+
+	// Configure the maximum number of distinct keys which may be fetched at
+	// once, bounding the memory used to coordinate fetches.  A Get which would
+	// fetch another key either waits until a fetch completes, if block is
+	// true, or returns ErrTooManyInFlight.  Gets which share a fetch already
+	// underway are unaffected.  Zero, the default, allows any number.
+	SetMaxInFlightFetches(maxInFlightFetches int, block bool)
+
+	// Configure how many callers may join a fetch started by another caller
+	// before a second, independent fetch of the key is started for the
+	// callers which follow, so that one stuck fetch cannot hold up or fail
+	// every caller at once.  The second fetch is never split in turn, and it
+	// is started even if the in-flight limit has been reached.  Whichever of
+	// the two fetches completes last leaves its item in the cache.  Zero, the
+	// default, has every caller share a single fetch.
+	SetMaxCoalesceBeforeSplit(n int)
+
+	// Configure a function which decides what a fetch stores when the item
+	// for its key was stored by a concurrent write, such as a split fetch or
+	// Set, while the fetch was in flight.  It is given the existing and the
+	// fetched items, and the item it returns is stored and returned to the
+	// fetch's callers.  It is called with the cache locked, so it must be
+	// quick and must not use the cache.  FirstWriteWins and LastWriteWins are
+	// ready-made resolvers.  Nil, the default, lets the last write win.
+	SetConflictResolver(resolver func(key string, existing, incoming SnapshotEntry) SnapshotEntry)
+
+	// Configure whether to count how often each item is found in the cache,
+	// for TopKeys.  Counting costs an atomic increment on each hit.  False,
+	// the default, disables counting.
+	SetTrackKeyAccess(track bool)
+
+	// Configure whether an item expires once the duration until its
+	// expiration time, as it was when the item was stored, has elapsed,
+	// rather than at the expiration time itself.  Elapsed time is measured by
+	// the clock's Since method if it has one, so that with the real clock it
+	// is unaffected by changes to the wall clock.  Items stored while this is
+	// false keep their absolute expiration times.  False is the default.
+	SetMonotonicExpiry(monotonic bool)
+
+	// Configure what to do when the item fetcher returns an item whose
+	// expiration time has already passed, after any TTL override, which would
+	// otherwise be fetched again on every Get.  For PastExpiryMinimumTTL, the
+	// item is cached for the given minimum TTL.  A warning is logged whenever
+	// the policy is applied.  PastExpiryAllow is the default.
+	SetPastExpiryPolicy(policy PastExpiryPolicy, minimumTTL time.Duration)
+
+	// Configure a TTL for fetched items whose keys start with the given
+	// prefix, applied when the item fetcher returns a zero expiration time.
+	// Where several configured prefixes match a key, the longest applies.
+	// Prefix TTLs take precedence over the cost-based TTL.  A TTL of zero
+	// removes the prefix.
+	SetPrefixTTL(prefix string, ttl time.Duration)
+
+	// Configure a function computing a stable hash of a value, to be used as
+	// its ETag; see GetWithETag.  Nil, the default, leaves ETags empty.
+	SetETagFunc(etagFunc func(value interface{}) string)
+
+	// Configure the ID of this node, recorded as the origin of the items it
+	// fetches or sets; see GetWithOrigin.  The default is the empty string.
+	SetNodeID(id string)
+
+	// Configure the eviction priority tier of keys which start with the given
+	// prefix.  When the cache is purged, items in lower tiers are purged
+	// before any in higher tiers.  Where several configured prefixes match a
+	// key, the longest applies; keys which match none are in tier zero.
+	SetPriorityTier(prefix string, tier int)
+
+	// Configure a function to be called whenever a background refresh
+	// completes, with the refreshed value or the refresh's error.  It is not
+	// called for fetches which a caller waits on.
+	SetOnRefresh(onRefresh func(key string, newValue interface{}, err error))
+
+	// Configure a function to be called with the key of each local write:
+	// each Delete, Set and other call which stores or removes an item, but
+	// not fetches.  It is called after the write, and can be wired to a
+	// transport which feeds the invalidation listeners of other caches, so
+	// that they drop their copies.  Nil, the default, publishes nothing.
+	SetInvalidationPublisher(publish func(key string))
+}
+
+// Source describes where Get found an item.
+type Source int
+
+const (
+	// The item was already in the cache.
+	SourceCache Source = iota
+
+	// The item was loaded from the L2 store.
+	SourceL2
+
+	// The item was fetched by the primary item fetcher.
+	SourcePrimary
+
+	// The item was fetched by the fallback item fetcher.
+	SourceFallback
+
+	// The item was reloaded from the spill store; see SetSpillStore.
+	SourceSpill
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceCache:
+		return "cache"
+	case SourceL2:
+		return "l2"
+	case SourcePrimary:
+		return "primary"
+	case SourceFallback:
+		return "fallback"
+	case SourceSpill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// Observer receives notification of cache activity.  Observers are called
+// after the cache's locks have been released, so an observer may safely call
+// back into the cache, but a slow observer slows the goroutine which
+// triggered the event.
+type Observer interface {
+	// Called when Get is satisfied by the cache.
+	OnHit(key string)
+
+	// Called when Get is not satisfied by the cache.
+	OnMiss(key string)
+
+	// Called when the item fetcher returns, with the time it took to fetch.
+	OnFetch(key string, duration time.Duration, err error)
+
+	// Called when an item is removed from the cache.
+	OnEvict(key string, reason EvictionReason)
+}
+
+// EvictionReason describes why an item was removed from the cache.
+type EvictionReason int
+
+const (
+	// The item was purged because the cache grew to its configured size.
+	EvictionCapacity EvictionReason = iota
+
+	// The item was removed because it had expired.
+	EvictionExpired
+
+	// The item was removed by Delete.
+	EvictionDeleted
+
+	// The item was removed because the configured validator rejected it.
+	EvictionInvalid
+
+	// The item was removed because its value, held weakly, was reclaimed by
+	// the garbage collector.
+	EvictionReclaimed
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionCapacity:
+		return "capacity"
+	case EvictionExpired:
+		return "expired"
+	case EvictionDeleted:
+		return "deleted"
+	case EvictionInvalid:
+		return "invalid"
+	case EvictionReclaimed:
+		return "reclaimed"
+	}
+	return "unknown"
+}
+
+// KeyStatus describes whether the cache holds an item for a key.
+type KeyStatus int
+
+const (
+	// The cache holds no item for the key.
+	StatusAbsent KeyStatus = iota
+
+	// The cache holds an unexpired item for the key.
+	StatusFresh
+
+	// The cache holds an item for the key, but it has expired.
+	StatusStale
+)
+
+func (s KeyStatus) String() string {
+	switch s {
+	case StatusAbsent:
+		return "absent"
+	case StatusFresh:
+		return "fresh"
+	case StatusStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// PastExpiryPolicy decides what to do with a fetched item whose expiration
+// time has already passed; see SetPastExpiryPolicy.
+type PastExpiryPolicy int
+
+const (
+	// Cache the item as it is.  Getting it again fetches it again.
+	PastExpiryAllow PastExpiryPolicy = iota
+	// Fail the fetch with ErrPastExpiry.
+	PastExpiryError
+	// Cache the item for a minimum time to live instead.
+	PastExpiryMinimumTTL
+	// Return the item without caching it.
+	PastExpiryDontCache
+)
+
+func (p PastExpiryPolicy) String() string {
+	switch p {
+	case PastExpiryAllow:
+		return "allow"
+	case PastExpiryError:
+		return "error"
+	case PastExpiryMinimumTTL:
+		return "minimum TTL"
+	case PastExpiryDontCache:
+		return "don't cache"
+	}
+	return "unknown"
+}
+
+// ExpiredEntry is an expired item which has been removed from the cache.
+// ExpiresAt is the item's own expiration time; if the item expired because
+// its generation was ended by BumpGeneration, Superseded is true.
+type ExpiredEntry struct {
+	Key        string
+	Value      interface{}
+	ExpiresAt  time.Time
+	Superseded bool
+}
+
+// KeyCount is the number of times an item was found in the cache; see TopKeys.
+type KeyCount struct {
+	Key   string
+	Count uint64
+}
+
+// InFlightFetch is a fetch which has not yet completed; see InFlight.
+type InFlightFetch struct {
+	Key     string
+	Started time.Time
+}
+
+// HistoricalValue is a value once stored for a key; see History.
+type HistoricalValue struct {
+	Value    interface{}
+	StoredAt time.Time
+}
+
+// SnapshotEntry is an item copied out of the cache by Snapshot.
+type SnapshotEntry struct {
+	Value     interface{}
+	ExpiresAt time.Time
+}
+
+// ErrNoGetter is returned by Get when the cache was constructed by NewLazy and
+// no item fetcher has been configured yet.
+var ErrNoGetter = errors.New("readcache: no getter has been configured")
+
+// ErrKeyTooLong is returned when a key is longer than the configured maximum.
+var ErrKeyTooLong = errors.New("readcache: key is too long")
+
+// ErrTooManyInFlight is returned when the configured number of in-flight
+// fetches has been reached and excess fetches are rejected.
+var ErrTooManyInFlight = errors.New("readcache: too many fetches in flight")
+
+// ErrPastExpiry is returned when the item fetcher returns an item which has
+// already expired and the past expiry policy is PastExpiryError.
+var ErrPastExpiry = errors.New("readcache: fetched item has already expired")
+
+// ErrTimeout is returned when an item could not be fetched before a deadline.
+var ErrTimeout = errors.New("readcache: timed out waiting for fetch")
+
+// ErrNotFound may be returned, possibly wrapped, by an item fetcher to report
+// that there is no item for a key, as opposed to a failure to fetch it.  Like
+// any fetch error, it is remembered for the error backoff, so that it serves
+// as a tombstone for the key; see GetOrDefaultOnNotFound.
+var ErrNotFound = errors.New("readcache: item not found")
+
+// FetchError wraps an error returned by an item fetcher, so that callers can
+// tell it apart from the errors the cache returns of its own accord, such as
+// ErrTimeout or ErrBackendUnavailable.  Its message is that of the wrapped
+// error, and errors.Is and errors.As see through it to the wrapped error.
+type FetchError struct {
+	// The key which was being fetched
+	Key string
+
+	// The error returned by the item fetcher
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// New constructs a new cache.  The item fetcher may return an item of type interface {} with an
+// expiration time, or it may return an error.  If an error is returned, then all other return values are ignored.
+func New(getter func(string) (interface{}, time.Time, error)) CacheWithSettings {
+	return newReadcache(getter)
+}
+
+// NewWithContext constructs a new cache whose item fetcher is given a context,
+// which is canceled if the fetch is abandoned; see DeleteAndCancel.
+func NewWithContext(getter func(ctx context.Context, key string) (interface{}, time.Time, error)) CacheWithSettings {
+	c := newReadcache(nil)
+	c.Settings.ContextGetter = getter
+	return c
+}
+
+// NewLazy constructs a new cache without an item fetcher.  Until SetGetter is
+// called, every Get which is not satisfied by the cache returns ErrNoGetter.
+func NewLazy() CacheWithSettings {
+	return newReadcache(nil)
+}
+
+func newReadcache(getter func(string) (interface{}, time.Time, error)) *readcache {
+	readControlsLock := new(sync.RWMutex)
+	return &readcache{
+		Settings:          &Config{Getter: getter, CacheNilValues: true, Clock: realClock{}},
+		SettingsLock:      new(sync.RWMutex),
+		Cache:             make(map[string]*cacheable),
+		ReadControls:      make(map[string]*readControl),
+		CacheLock:         new(sync.RWMutex),
+		ReadControlsLock:  readControlsLock,
+		ReadControlsFreed: sync.NewCond(readControlsLock),
+		Additions:         list.New(),
+		Pinned:            make(map[string]bool),
+		Dependents:        make(map[string]map[string]bool),
+		Dependencies:      make(map[string]map[string]bool),
+		Interned:          make(map[internedHash]map[string]bool),
+		InternedKeys:      make(map[string]internedHash),
+		ErrorBackoffs:     newErrorBackoff(defaultErrorBackoffSize),
+		FetchSlots:        newFetchSlots(),
+		Breaker:           newCircuitBreaker(),
+		Guard:             newPenetrationGuard(),
+		WriteBehind:       newWriteBehind(),
+		EvictCallbacks:    newEvictCallbacks(),
+		Events:            newEventBuffer(),
+		Watchers:          newWatchers(),
+		WarmingStop:       make(chan struct{}),
+		WarmingLock:       new(sync.Mutex),
+		StatsLock:         new(sync.Mutex),
+	}
+}
+
+// CacheStats describes the current contents of a cache.
+type CacheStats struct {
+	// The number of entries held in the cache, including expired entries which
+	// have not yet been removed.
+	Entries int
+
+	// The number of entries which have expired but have not yet been removed.
+	Expired int
+
+	// The number of unexpired entries which will expire within the next minute.
+	ExpiringWithinMinute int
+
+	// The number of unexpired entries which will expire within the next hour.
+	// This includes the entries counted by ExpiringWithinMinute.
+	ExpiringWithinHour int
+
+	// The average remaining time to live of the unexpired entries, or zero
+	// if there are none.
+	AverageTTL time.Duration
+
+	// The number of writes to the L2 store which have been dropped because
+	// the write-behind queue was full.
+	DroppedL2Writes uint64
+
+	// The number of calls of the eviction callback which have been dropped
+	// because a worker's queue was full; see SetAsyncEvictCallbacks.
+	DroppedEvictCallbacks uint64
+
+	// The number of times an item has been found in the cache since it was
+	// constructed, and how many of those found an unexpired item and how many
+	// an expired one, as served by stale-while-revalidate or WithAllowStale.
+	Hits      uint64
+	FreshHits uint64
+	StaleHits uint64
+
+	// The number of background refreshes which have been started since the
+	// cache was constructed.
+	BackgroundRefreshes uint64
+
+	// The number of fetched items which were not cached because they were
+	// larger than the configured maximum; see SetMaxEntryBytes.
+	OversizedRejected uint64
+
+	// The number of entries held serialized by a value codec, and the total
+	// size of their serialized values in bytes.  Compared with the size of the
+	// values themselves, this gives the memory saved by the codec.
+	EncodedEntries int
+	EncodedBytes   int
+}
+
+// Type evictedItem is an item which has been removed from the cache, pending
+// notification of the eviction once locks have been released.
+type evictedItem struct {
+	Key    string
+	Item   *cacheable
+	Reason EvictionReason
+}
+
+// Type cacheable is something that may be stored in a cache
+type cacheable struct {
+	// The item in the cache
+	Value interface{}
+
+	// The time at which this item should expire from the cache.
+	ExpiresAt time.Time
+
+	// The version of this item; see GetVersioned.
+	Version uint64
+
+	// The generation of the cache when this item was stored; see BumpGeneration.
+	Generation uint64
+
+	// The ETag of the item's value, if an ETag function was configured when the
+	// item was created.
+	ETag string
+
+	// Where and when this item originated; see GetWithOrigin.
+	Origin Origin
+
+	// The time at which this item was stored, and how long from then until it
+	// expires, if expiry was monotonic when it was stored; see expiryTime.
+	FetchedAt time.Time
+	TTL       time.Duration
+
+	// The number of times this item has been found in the cache, if key
+	// access tracking was enabled when it was stored.  Shared by the copies
+	// made by sliding expiration.
+	Accesses *atomic.Uint64
+
+	// The number of hits on this item since it expired, if refetch sampling
+	// was configured when it was stored; see SetRefetchSampling.
+	StaleHits *atomic.Uint64
+
+	// How recently and how often this item has been used, if the eviction
+	// policy was LRU or LFU when it was stored or the policy was switched.
+	Use *itemUse
+
+	// The codec the value was encoded with, if it is held serialized; see
+	// SetValueCodec.
+	Codec Codec
+
+	// The most recent values stored for the key, ending with this item's own,
+	// if a history depth was configured when it was stored.
+	History []HistoricalValue
+
+	// The weak pointer through which the value is held, and the value's
+	// pointer type, if it is held weakly; see SetWeakValues.
+	Weak     weak.Pointer[byte]
+	WeakType reflect.Type
+}
+
+// Type readControl is a mechanism for controlling concurrent fetches
+type readControl struct {
+	Controller *sync.Once
+	Result     *cacheable
+	Error      error
+
+	// Closed once the fetch has completed and Result or Error is set.
+	Done chan struct{}
+
+	// Where the result came from.
+	Source Source
+
+	// When the fetch was requested.
+	Started time.Time
+
+	// How long the fetch spent in the item fetchers.
+	Elapsed time.Duration
+
+	// The number of callers which have joined the fetch after it was
+	// requested, and whether it overflowed from another read control for the
+	// same key; see SetMaxCoalesceBeforeSplit.
+	Waiters  atomic.Int64
+	Overflow bool
+
+	// The context given to a context-aware item fetcher, and the function
+	// which cancels it; see DeleteAndCancel.  Canceled once the fetch is done.
+	Context context.Context
+	Cancel  context.CancelFunc
+}
+
+// Create a read control for a fetch requested now.
+func newReadControl(overflow bool) *readControl {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &readControl{
+		Controller: new(sync.Once),
+		Done:       make(chan struct{}),
+		Started:    time.Now(),
+		Overflow:   overflow,
+		Context:    ctx,
+		Cancel:     cancel,
+	}
+}
+
+// Type readcache implements the Cache interface
+type readcache struct {
+	// The tunable settings.  The settings are replaced, never modified, so that
+	// an operation may use the settings it started with throughout.
+	Settings *Config
+
+	// Locks the settings for reads or writes
+	SettingsLock *sync.RWMutex
+
+	// The cache of items
+	Cache map[string]*cacheable
+
+	// Controls read of items from the getter; prevents multiple concurrent reads of the same item.
+	ReadControls map[string]*readControl
+
+	// Locks the entire cache for reads or writes
+	CacheLock *sync.RWMutex
+
+	// Locks the read control manifest for reads or writes
+	ReadControlsLock *sync.RWMutex
+
+	// Signalled whenever a read control is removed.  Uses ReadControlsLock
+	// for writes.
+	ReadControlsFreed *sync.Cond
+
+	// A history of item additions, used to determine which items to purge.  Not
+	// to be confused with the value history of each item; see SetHistoryDepth.
+	Additions *list.List
+
+	// The number of items in the history
+	AdditionCount int
+
+	// The version most recently given to an item.
+	LastVersion uint64
+
+	// Keys which are exempt from purging.  Guarded by CacheLock.
+	Pinned map[string]bool
+
+	// For each key, the keys which directly depend on it, and the keys on
+	// which it directly depends.  Guarded by CacheLock.
+	Dependents   map[string]map[string]bool
+	Dependencies map[string]map[string]bool
+
+	// The keys whose fetched values may be shared with other keys, by the
+	// type and hash of the value, and the index of each such key; see
+	// SetInterning.  A key is dropped when its item leaves the cache.
+	// Guarded by CacheLock.
+	Interned     map[internedHash]map[string]bool
+	InternedKeys map[string]internedHash
+
+	// The remembered fetch errors.
+	ErrorBackoffs *errorBackoff
+
+	// Limits the number of concurrent fetches.
+	FetchSlots *fetchSlots
+
+	// Fails fetches fast while the item fetcher is known to be down.
+	Breaker *circuitBreaker
+
+	// Short-circuits fetches of keys which are very likely absent.
+	Guard *penetrationGuard
+
+	// Queues writes to the L2 store, if they are made behind.
+	WriteBehind *writeBehind
+
+	// Queues calls of the eviction callback, if they are made asynchronously.
+	EvictCallbacks *evictCallbacks
+
+	// Retains recent events for observers registered later.
+	Events *eventBuffer
+
+	// The channels of the callers watching keys.
+	Watchers *watchers
+
+	// Closed to stop the warmings started by WarmFromChannel, then replaced.
+	// Guarded by WarmingLock.
+	WarmingStop chan struct{}
+	WarmingLock *sync.Mutex
+
+	// The stats reported by the last call to StatsDelta.  Guarded by
+	// StatsLock.
+	StatsBaseline CacheStats
+	StatsLock     *sync.Mutex
+
+	// The current generation; items stored in earlier generations have expired.
+	Generation atomic.Uint64
+
+	// Ticks once for each use of an item, for the LRU and LFU policies.
+	UseClock atomic.Uint64
+
+	// The numbers of hits on fresh and stale items, of background refreshes
+	// started and of oversized items rejected; see CacheStats.
+	FreshHits           atomic.Uint64
+	StaleHits           atomic.Uint64
+	BackgroundRefreshes atomic.Uint64
+	OversizedRejected   atomic.Uint64
+
+	// Called, if set, as a Get passes each hook point, so that a test can
+	// hold up concurrent Gets to force a particular interleaving.  Set only
+	// by tests, before the cache is used.
+	Hook func(point hookPoint, key string)
+}
+
+// Type hookPoint identifies a point in a Get at which a test may hold it up;
+// see readcache.Hook.
+type hookPoint int
+
+const (
+	// The Get has started a fetch, before the item fetcher is called.
+	hookFetch hookPoint = iota
+
+	// The Get has joined a fetch started by another Get, and will wait for it.
+	hookJoin
+
+	// A store has purged a chunk of items and released the cache lock
+	// before purging the next; see SetEvictionChunkSize.
+	hookPurgeChunk
+)
+
+// Call the test hook, if one is set, at a hook point.
+func runHook(c *readcache, point hookPoint, key string) {
+	if c.Hook != nil {
+		c.Hook(point, key)
+	}
+}
+
+// Get an item from the cache, retrieving the item from the getter if necessary.
+// This implemention is meant to be goroutine safe.  It assumes that updating a
+// map while concurrently reading from it is unsafe, so it uses a read/write mutex
+// to synchronize access to its internal maps.
+func (c *readcache) Get(key string) (interface{}, error) {
+	cachedValue, err := get(c, settings(c), key)
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetWithOptions(key string, opts ...GetOption) (interface{}, error) {
+	if len(opts) == 0 {
+		return c.Get(key)
+	}
+	cachedValue, err := getWithOptions(c, settings(c), key, opts)
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetVersioned(key string) (interface{}, uint64, error) {
+	cachedValue, err := get(c, settings(c), key)
+	if cachedValue != nil {
+		return cachedValue.Value, cachedValue.Version, err
+	}
+
+	return nil, 0, err
+}
+
+func (c *readcache) GetSourced(key string) (interface{}, Source, error) {
+	cfg := settings(c)
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	source := SourceCache
+	if readControl != nil {
+		cachedValue, err = doFetch(c, cfg, key, readControl, nil, 0)
+		source = readControl.Source
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, source, err
+	}
+
+	return nil, source, err
+}
+
+func (c *readcache) GetBefore(key string, deadline time.Time) (interface{}, error) {
+	cfg := settings(c)
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	if readControl != nil {
+		go doFetch(c, cfg, key, readControl, nil, 0)
+		cachedValue, err = awaitFetch(readControl, deadline, nil)
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetWithPriority(key string, priority int) (interface{}, error) {
+	cachedValue, err := getWithPriority(c, settings(c), key, priority)
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetWithTTL(key string, ttl time.Duration) (interface{}, error) {
+	cfg := settings(c)
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	if readControl != nil {
+		ttlCfg := *cfg
+		ttlCfg.TTLOverride = func(string, interface{}, time.Time) time.Time {
+			return cfg.Clock.Now().Add(ttl)
+		}
+		cachedValue, err = doFetch(c, &ttlCfg, key, readControl, nil, 0)
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetForceRefresh(key string) (interface{}, error) {
+	cfg := settings(c)
+	if err := checkKey(cfg, key); err != nil {
+		return nil, err
+	}
+	readControl, _, _, _, err := getReadControl(c, cfg, key, false)
+	if err != nil {
+		return nil, err
+	}
+	cachedValue, err := doFetch(c, cfg, key, readControl, nil, 0)
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetOrDefaultOnNotFound(key string, def interface{}) (interface{}, error) {
+	cachedValue, err := get(c, settings(c), key)
+	if errors.Is(err, ErrNotFound) {
+		return def, nil
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) GetWithETag(key string) (interface{}, string, error) {
+	cachedValue, err := get(c, settings(c), key)
+	if cachedValue != nil {
+		return cachedValue.Value, cachedValue.ETag, err
+	}
+
+	return nil, "", err
+}
+
+func (c *readcache) GetWithOrigin(key string) (interface{}, Origin, error) {
+	cachedValue, err := get(c, settings(c), key)
+	if cachedValue != nil {
+		return cachedValue.Value, cachedValue.Origin, err
+	}
+
+	return nil, Origin{}, err
+}
+
+func (c *readcache) GetNoFetch(key string) (interface{}, bool, error) {
+	cfg := settings(c)
+	if err := checkKey(cfg, key); err != nil {
+		return nil, false, err
+	}
+
+	if cachedValue, ok, stale := getFromCache(c, cfg, key); ok {
+		countHit(c, stale)
+		notifyHit(c, cfg, key)
+		cachedValue, err := decodeItem(cachedValue)
+		if err != nil {
+			return nil, false, err
+		}
+		return cachedValue.Value, true, nil
+	}
+	notifyMiss(c, cfg, key)
+
+	c.ReadControlsLock.RLock()
+	readControl, ok := c.ReadControls[key]
+	c.ReadControlsLock.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	<-readControl.Done
+	if readControl.Error != nil {
+		return nil, false, readControl.Error
+	}
+	if readControl.Result == nil {
+		return nil, false, nil
+	}
+	return readControl.Result.Value, true, nil
+}
+
+func (c *readcache) Compute(key string, fn func() (interface{}, time.Time, error)) (interface{}, error) {
+	cfg := settings(c)
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	if readControl != nil {
+		cachedValue, err = doFetch(c, cfg, key, readControl, func(string) (interface{}, time.Time, error) {
+			return fn()
+		}, 0)
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, err
+	}
+
+	return nil, err
+}
+
+func (c *readcache) Set(key string, value interface{}, expiresAt time.Time) error {
+	cfg := settings(c)
+	if extendRedundant(c, cfg, key, value, expiresAt) {
+		return nil
+	}
+	if err := set(c, cfg, key, value, expiresAt); err != nil {
+		return err
+	}
+	publishInvalidation(cfg, key)
+	return nil
+}
+
+// Change only the expiration time of the item for a key, if redundant sets
+// are suppressed and the item's value equals the given one, unless another
+// goroutine replaces the item in the meantime.  Reports whether it was
+// changed.
+func extendRedundant(c *readcache, cfg *Config, key string, value interface{}, expiresAt time.Time) bool {
+	if cfg.SuppressRedundantSet == nil {
+		return false
+	}
+	c.CacheLock.RLock()
+	item, ok := c.Cache[key]
+	c.CacheLock.RUnlock()
+	if !ok || item.Generation != c.Generation.Load() || reclaimed(item) || !cfg.SuppressRedundantSet(decodedValue(item), value) {
+		return false
+	}
+
+	_, replaced := replaceExpiration(c, key, item, expiresAt, cfg.Clock.Now())
+	return replaced
+}
+
+// Store an item in the cache, replacing any existing item for the key.
+func set(c *readcache, cfg *Config, key string, value interface{}, expiresAt time.Time) error {
+	if err := checkKey(cfg, key); err != nil {
+		return err
+	}
+	item := newItem(cfg, value, expiresAt)
+	c.CacheLock.Lock()
+	evicted := storeItem(c, cfg, key, item)
+	c.CacheLock.Unlock()
+	notifyEvictions(c, cfg, evicted)
+	storeToL2(c, cfg, key, item)
+	return nil
+}
+
+func (c *readcache) SetIfVersion(key string, value interface{}, expiresAt time.Time, expectedVersion uint64) bool {
+	cfg := settings(c)
+	if checkKey(cfg, key) != nil {
+		return false
+	}
+	item := newItem(cfg, value, expiresAt)
+	c.CacheLock.Lock()
+	var version uint64
+	if cachedValue, ok := c.Cache[key]; ok {
+		version = cachedValue.Version
+	}
+	if version != expectedVersion {
+		c.CacheLock.Unlock()
+		return false
+	}
+	evicted := storeItem(c, cfg, key, item)
+	c.CacheLock.Unlock()
+	notifyEvictions(c, cfg, evicted)
+	storeToL2(c, cfg, key, item)
+	publishInvalidation(cfg, key)
+	return true
+}
+
+func (c *readcache) Replace(key string, value interface{}, expiresAt time.Time) bool {
+	cfg := settings(c)
+	if checkKey(cfg, key) != nil {
+		return false
+	}
+
+	item := newItem(cfg, value, expiresAt)
+	c.CacheLock.Lock()
+	if _, ok := c.Cache[key]; !ok {
+		c.CacheLock.Unlock()
+		return false
+	}
+	evicted := storeItem(c, cfg, key, item)
+	c.CacheLock.Unlock()
+	notifyEvictions(c, cfg, evicted)
+	storeToL2(c, cfg, key, item)
+	publishInvalidation(cfg, key)
+	return true
+}
+
+func (c *readcache) Add(key string, value interface{}, expiresAt time.Time) bool {
+	cfg := settings(c)
+	if checkKey(cfg, key) != nil {
+		return false
+	}
+
+	item := newItem(cfg, value, expiresAt)
+
+	// Warning: possibility of deadlock when dealing with multiple locks.  Make sure
+	//          they are always acquired in the same order.
+	c.ReadControlsLock.RLock()
+	_, fetching := c.ReadControls[key]
+	c.CacheLock.Lock()
+	_, present := c.Cache[key]
+	if fetching || present {
+		c.CacheLock.Unlock()
+		c.ReadControlsLock.RUnlock()
+		return false
+	}
+	evicted := storeItem(c, cfg, key, item)
+	c.CacheLock.Unlock()
+	c.ReadControlsLock.RUnlock()
+	notifyEvictions(c, cfg, evicted)
+	storeToL2(c, cfg, key, item)
+	publishInvalidation(cfg, key)
+	return true
+}
+
+func (c *readcache) Delete(key string) {
+	cfg := settings(c)
+	deleteWithDependents(c, cfg, key)
+	publishInvalidation(cfg, key)
+}
+
+func (c *readcache) DeleteAndCancel(key string) {
+	c.ReadControlsLock.RLock()
+	control, ok := c.ReadControls[key]
+	c.ReadControlsLock.RUnlock()
+	if ok {
+		cancelFetch(c, key, control)
+	}
+	cfg := settings(c)
+	deleteWithDependents(c, cfg, key)
+	publishInvalidation(cfg, key)
+}
+
+// Cancel the context of a fetch, and remove its read control so that later
+// callers start a fetch of their own rather than sharing the canceled one.
+func cancelFetch(c *readcache, key string, control *readControl) {
+	c.ReadControlsLock.Lock()
+	control.Cancel()
+	if c.ReadControls[key] == control {
+		delete(c.ReadControls, key)
+		c.ReadControlsFreed.Broadcast()
+	}
+	c.ReadControlsLock.Unlock()
+}
+
+func (c *readcache) GetAndDelete(key string) (interface{}, bool) {
+	cfg := settings(c)
+	prev, hadPrev := deleteWithDependents(c, cfg, key)
+	publishInvalidation(cfg, key)
+	if !hadPrev {
+		return nil, false
+	}
+	return decodedValue(prev), true
+}
+
+func (c *readcache) GetAndSet(key string, value interface{}, expiresAt time.Time) (interface{}, bool) {
+	cfg := settings(c)
+	if checkKey(cfg, key) != nil {
+		return nil, false
+	}
+	item := newItem(cfg, value, expiresAt)
+	c.CacheLock.Lock()
+	prev, hadPrev := c.Cache[key]
+	evicted := storeItem(c, cfg, key, item)
+	c.CacheLock.Unlock()
+	notifyEvictions(c, cfg, evicted)
+	storeToL2(c, cfg, key, item)
+	publishInvalidation(cfg, key)
+	if !hadPrev {
+		return nil, false
+	}
+	return decodedValue(prev), true
+}
+
+func (c *readcache) AddDependency(dependent string, dependsOn string) {
+	c.CacheLock.Lock()
+	dependents, ok := c.Dependents[dependsOn]
+	if !ok {
+		dependents = make(map[string]bool)
+		c.Dependents[dependsOn] = dependents
+	}
+	dependents[dependent] = true
+	dependencies, ok := c.Dependencies[dependent]
+	if !ok {
+		dependencies = make(map[string]bool)
+		c.Dependencies[dependent] = dependencies
+	}
+	dependencies[dependsOn] = true
+	c.CacheLock.Unlock()
+}
+
+// Remove the dependencies of a key on other keys.  The caller must hold
+// CacheLock for writing.
+func forgetDependencies(c *readcache, dependent string) {
+	for dependsOn := range c.Dependencies[dependent] {
+		dependents := c.Dependents[dependsOn]
+		delete(dependents, dependent)
+		if len(dependents) == 0 {
+			delete(c.Dependents, dependsOn)
+		}
+	}
+	delete(c.Dependencies, dependent)
+}
+
+func (c *readcache) Pin(key string) {
+	c.CacheLock.Lock()
+	c.Pinned[key] = true
+	c.CacheLock.Unlock()
+}
+
+func (c *readcache) Unpin(key string) {
+	c.CacheLock.Lock()
+	delete(c.Pinned, key)
+	c.CacheLock.Unlock()
+}
+
+func (c *readcache) Status(key string) KeyStatus {
+	cfg := settings(c)
+	now := cfg.Clock.Now()
+	c.CacheLock.RLock()
+	cachedValue, ok := c.Cache[key]
+	c.CacheLock.RUnlock()
+
+	if !ok {
+		return StatusAbsent
+	}
+	if expiryTime(c, cfg, cachedValue, now).After(now) {
+		return StatusFresh
+	}
+	return StatusStale
+}
+
+func (c *readcache) Remaining(key string) (time.Duration, bool) {
+	cfg := settings(c)
+	now := cfg.Clock.Now()
+	c.CacheLock.RLock()
+	cachedValue, ok := c.Cache[key]
+	c.CacheLock.RUnlock()
+
+	if !ok {
+		return 0, false
+	}
+	remaining := expiryTime(c, cfg, cachedValue, now).Sub(now)
+	return remaining, remaining > 0
+}
+
+func (c *readcache) InFlight() []InFlightFetch {
+	c.ReadControlsLock.RLock()
+	fetches := make([]InFlightFetch, 0, len(c.ReadControls))
+	for key, control := range c.ReadControls {
+		fetches = append(fetches, InFlightFetch{key, control.Started})
+	}
+	c.ReadControlsLock.RUnlock()
+
+	sort.Slice(fetches, func(i, j int) bool {
+		return fetches[i].Started.Before(fetches[j].Started)
+	})
+	return fetches
+}
+
+// Report statistics about the current contents of the cache.  The expiry
+// distribution is computed by ranging over every entry under a read lock,
+// so the cost of this call grows with the size of the cache.
+func (c *readcache) Stats() CacheStats {
+	var stats CacheStats
+	var totalTTL time.Duration
+	cfg := settings(c)
+	now := cfg.Clock.Now()
+
+	c.CacheLock.RLock()
+	stats.Entries = len(c.Cache)
+	for _, item := range c.Cache {
+		if item.Codec != nil {
+			stats.EncodedEntries++
+			stats.EncodedBytes += len(item.Value.([]byte))
+		}
+		ttl := expiryTime(c, cfg, item, now).Sub(now)
+		if ttl <= 0 {
+			stats.Expired++
+			continue
+		}
+		totalTTL += ttl
+		if ttl <= time.Minute {
+			stats.ExpiringWithinMinute++
+		}
+		if ttl <= time.Hour {
+			stats.ExpiringWithinHour++
+		}
+	}
+	c.CacheLock.RUnlock()
+
+	if live := stats.Entries - stats.Expired; live > 0 {
+		stats.AverageTTL = totalTTL / time.Duration(live)
+	}
+	stats.DroppedL2Writes = c.WriteBehind.dropped()
+	stats.DroppedEvictCallbacks = c.EvictCallbacks.dropped()
+	stats.FreshHits = c.FreshHits.Load()
+	stats.StaleHits = c.StaleHits.Load()
+	stats.Hits = stats.FreshHits + stats.StaleHits
+	stats.BackgroundRefreshes = c.BackgroundRefreshes.Load()
+	stats.OversizedRejected = c.OversizedRejected.Load()
+	return stats
+}
+
+func (c *readcache) StatsDelta() CacheStats {
+	c.StatsLock.Lock()
+	defer c.StatsLock.Unlock()
+	stats := c.Stats()
+	delta, baseline := stats, c.StatsBaseline
+	c.StatsBaseline = stats
+
+	delta.DroppedL2Writes -= baseline.DroppedL2Writes
+	delta.DroppedEvictCallbacks -= baseline.DroppedEvictCallbacks
+	delta.Hits -= baseline.Hits
+	delta.FreshHits -= baseline.FreshHits
+	delta.StaleHits -= baseline.StaleHits
+	delta.BackgroundRefreshes -= baseline.BackgroundRefreshes
+	delta.OversizedRejected -= baseline.OversizedRejected
+	return delta
+}
+
+func (c *readcache) TopKeys(n int) []KeyCount {
+	var counts []KeyCount
+	c.CacheLock.RLock()
+	for key, item := range c.Cache {
+		if item.Accesses != nil {
+			counts = append(counts, KeyCount{key, item.Accesses.Load()})
+		}
+	}
+	c.CacheLock.RUnlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	if n < len(counts) {
+		counts = counts[:max(n, 0)]
+	}
+	return counts
+}
+
+func (c *readcache) BumpGeneration() {
+	c.Generation.Add(1)
+}
+
+func (c *readcache) DrainExpired() []ExpiredEntry {
+	cfg := settings(c)
+	var drained []ExpiredEntry
+	var evicted []evictedItem
+	now := cfg.Clock.Now()
+
+	c.CacheLock.Lock()
+	for key, item := range c.Cache {
+		if expiresAt := expiryTime(c, cfg, item, now); !expiresAt.After(now) {
+			deleteItem(c, key)
+			drained = append(drained, ExpiredEntry{key, decodedValue(item), item.ExpiresAt, item.Generation != c.Generation.Load()})
+			evicted = append(evicted, evictedItem{key, item, EvictionExpired})
+		}
+	}
+	c.CacheLock.Unlock()
+
+	notifyEvictions(c, cfg, evicted)
+	return drained
+}
+
+func (c *readcache) Snapshot() map[string]SnapshotEntry {
+	cfg := settings(c)
+	now := cfg.Clock.Now()
+
+	c.CacheLock.RLock()
+	snapshot := make(map[string]SnapshotEntry, len(c.Cache))
+	for key, item := range c.Cache {
+		if expiresAt := expiryTime(c, cfg, item, now); expiresAt.After(now) {
+			snapshot[key] = SnapshotEntry{decodedValue(item), expiresAt}
+		}
+	}
+	c.CacheLock.RUnlock()
+
+	return snapshot
 }
 
-// New constructs a new cache.  The item fetcher may return an item of type interface {} with an
-// expiration time, or it may return an error.  If an error is returned, then all other return values are ignored.
-func New(getter func(string) (interface{}, time.Time, error)) CacheWithSettings {
-	return &readcache{getter, make(map[string]*cacheable), make(map[string]*readControl), new(sync.RWMutex), new(sync.RWMutex), 0, 0, list.New(), 0}
-}
+func (c *readcache) KeysMatching(pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cfg := settings(c)
+	now := cfg.Clock.Now()
 
-// Type cacheable is something that may be stored in a cache
-type cacheable struct {
-	// The item in the cache
-	Value interface{}
+	var keys []string
+	c.CacheLock.RLock()
+	for key, item := range c.Cache {
+		if re.MatchString(key) && expiryTime(c, cfg, item, now).After(now) {
+			keys = append(keys, key)
+		}
+	}
+	c.CacheLock.RUnlock()
 
-	// The time at which this item should expire from the cache.
-	ExpiresAt time.Time
+	slices.Sort(keys)
+	return keys, nil
 }
 
-// Type readControl is a mechanism for controlling concurrent fetches
-type readControl struct {
-	Controller *sync.Once
-	Result     *cacheable
-	Error      error
+func (c *readcache) History(key string) []HistoricalValue {
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	if item, ok := c.Cache[key]; ok {
+		return slices.Clone(item.History)
+	}
+	return nil
 }
 
-// Type readcache implements the Cache interface
-type readcache struct {
-	// The fetcher of items
-	Getter func(string) (interface{}, time.Time, error)
-
-	// The cache of items
-	Cache map[string]*cacheable
+// Remove the item for a key from the cache and the L2 store, along with the
+// items for every key which depends on it, returning the removed item for the
+// key itself.
+func deleteWithDependents(c *readcache, cfg *Config, key string) (prev *cacheable, hadPrev bool) {
+	prev, hadPrev, keys := removeWithDependents(c, cfg, key)
+	deleteFromL2(c, cfg, keys)
+	return
+}
 
-	// Controls read of items from the getter; prevents multiple concurrent reads of the same item.
-	ReadControls map[string]*readControl
+// Remove the item for a key from the cache and the spill store, along with the
+// items for every key which depends on it, leaving the L2 store alone.
+// Returns the removed item for the key itself and every key visited.
+func removeWithDependents(c *readcache, cfg *Config, key string) (prev *cacheable, hadPrev bool, keys []string) {
+	var evicted []evictedItem
+	visited := map[string]bool{key: true}
+	pending := []string{key}
 
-	// Locks the entire cache for reads or writes
-	CacheLock *sync.RWMutex
+	c.CacheLock.Lock()
+	prev, hadPrev = c.Cache[key]
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if item, ok := c.Cache[next]; ok {
+			deleteItem(c, next)
+			evicted = append(evicted, evictedItem{next, item, EvictionDeleted})
+		}
+		for dependent := range c.Dependents[next] {
+			if !visited[dependent] {
+				visited[dependent] = true
+				pending = append(pending, dependent)
+			}
+		}
+		delete(c.Dependents, next)
+		forgetDependencies(c, next)
+	}
+	c.CacheLock.Unlock()
 
-	// Locks the read control manifest for reads or writes
-	ReadControlsLock *sync.RWMutex
+	notifyEvictions(c, cfg, evicted)
+	keys = make([]string, 0, len(visited))
+	for deleted := range visited {
+		keys = append(keys, deleted)
+	}
+	dropSpilled(cfg, keys)
+	return
+}
 
-	// The cache size at which the cache will be purged
-	PurgeAt int
+// Get an item from the cache, retrieving the item from the getter if necessary.
+func get(c *readcache, cfg *Config, key string) (*cacheable, error) {
+	return getWithPriority(c, cfg, key, 0)
+}
 
-	// The resulting size of the cache after a purge.
-	PurgeTo int
+// Get an item as get does, fetching it with the given priority if necessary.
+func getWithPriority(c *readcache, cfg *Config, key string, priority int) (*cacheable, error) {
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	if readControl != nil {
+		return doFetch(c, cfg, key, readControl, nil, priority)
+	}
 
-	// A history of item additions, used to determine which items to purge.
-	History *list.List
+	return cachedValue, err
+}
 
-	// The number of items in the history
-	HistoryCount int
+// Get an item from the cache if available, reporting the hit or miss.  If the
+// item is not available, the read control for fetching it is returned instead.
+// If a recent fetch of the item failed and is being backed off, that fetch's
+// error is returned instead.
+func getOrReadControl(c *readcache, cfg *Config, key string) (*cacheable, *readControl, error) {
+	cachedValue, readControl, _, err := getOrStartReadControl(c, cfg, key)
+	return cachedValue, readControl, err
 }
 
-// Get an item from the cache, retrieving the item from the getter if necessary.
-// This implemention is meant to be goroutine safe.  It assumes that updating a
-// map while concurrently reading from it is unsafe, so it uses a read/write mutex
-// to synchronize access to its internal maps.
-func (c *readcache) Get(key string) (interface{}, error) {
-	cachedValue, ok := getFromCache(c, key)
+// Get an item from the cache as getOrReadControl does, also reporting whether
+// the returned read control was created for this call, rather than joined.
+func getOrStartReadControl(c *readcache, cfg *Config, key string) (*cacheable, *readControl, bool, error) {
+	if err := checkKey(cfg, key); err != nil {
+		return nil, nil, false, err
+	}
+
+	cachedValue, ok, stale := getFromCache(c, cfg, key)
 	if ok {
-		return cachedValue.Value, nil
+		countHit(c, stale)
+		notifyHit(c, cfg, key)
+		if stale && sampleRefetch(cfg, cachedValue) {
+			refresh(c, cfg, key)
+		}
+		cachedValue, err := decodeItem(cachedValue)
+		return cachedValue, nil, false, err
+	}
+	notifyMiss(c, cfg, key)
+
+	if cfg.ErrorBackoff > 0 {
+		if err, ok := c.ErrorBackoffs.get(key, cfg.Clock.Now()); ok {
+			return nil, nil, false, err
+		}
 	}
 
-	readControl, cachedValue, ok := getReadControl(c, key)
+	readControl, cachedValue, ok, joined, err := getReadControl(c, cfg, key, true)
+	if err != nil {
+		return nil, nil, false, err
+	}
 	if ok {
-		return cachedValue.Value, nil
+		cachedValue, err := decodeItem(cachedValue)
+		return cachedValue, nil, false, err
 	}
+	return nil, readControl, !joined, nil
+}
 
-	cachedValue, err := doFetch(c, key, readControl)
-	if cachedValue != nil {
-		return cachedValue.Value, err
+// Apply the configured policy to a fetched item's expiration time, if it has
+// already passed.  Returns the expiration time to use, whether the item may be
+// cached, or ErrPastExpiry if the fetch is to fail instead.
+func checkExpiry(cfg *Config, key string, expiresAt time.Time) (time.Time, bool, error) {
+	now := cfg.Clock.Now()
+	if cfg.PastExpiryPolicy == PastExpiryAllow || expiresAt.After(now) {
+		return expiresAt, true, nil
+	}
+	if cfg.Logger != nil {
+		cfg.Logger.Warn("readcache: fetched item has already expired", "key", key, "expiresAt", expiresAt, "policy", cfg.PastExpiryPolicy)
 	}
+	switch cfg.PastExpiryPolicy {
+	case PastExpiryError:
+		return expiresAt, false, ErrPastExpiry
+	case PastExpiryMinimumTTL:
+		return now.Add(cfg.PastExpiryMinimumTTL), true, nil
+	}
+	return expiresAt, false, nil
+}
 
-	return nil, err
+// Determine whether a fetched value is larger than the configured maximum,
+// as measured by the configured sizer, logging it if so.
+func oversized(cfg *Config, key string, value interface{}) bool {
+	if cfg.Sizer == nil || cfg.MaxEntryBytes <= 0 {
+		return false
+	}
+	size := cfg.Sizer(value)
+	if size <= cfg.MaxEntryBytes {
+		return false
+	}
+	if cfg.Logger != nil {
+		cfg.Logger.Warn("readcache: fetched item is too large to cache", "key", key, "size", size, "limit", cfg.MaxEntryBytes)
+	}
+	return true
+}
+
+// Check that a key is acceptable to the cache.
+func checkKey(cfg *Config, key string) error {
+	if cfg.MaxKeyLength > 0 && len(key) > cfg.MaxKeyLength {
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+// Wait for the fetch controlled by the given read control to complete, giving
+// up at the deadline, if there is one, with ErrTimeout, or once the context,
+// if there is one, is done, with the context's error.
+func awaitFetch(readControl *readControl, deadline time.Time, ctx context.Context) (cachedValue *cacheable, err error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	select {
+	case <-readControl.Done:
+		return readControl.Result, readControl.Error
+	case <-timeout:
+		err = ErrTimeout
+	case <-done:
+		err = ctx.Err()
+	}
+
+	// A fetch which completed just as waiting gave up still counts.
+	select {
+	case <-readControl.Done:
+		return readControl.Result, readControl.Error
+	default:
+		return nil, err
+	}
+}
+
+// Create an item to be stored in the cache, computing its ETag if configured.
+// The item originates from this node, now.
+func newItem(cfg *Config, value interface{}, expiresAt time.Time) *cacheable {
+	item := &cacheable{Value: value, ExpiresAt: expiresAt, Origin: Origin{cfg.NodeID, cfg.Clock.Now()}}
+	if cfg.ETagFunc != nil {
+		item.ETag = cfg.ETagFunc(value)
+	}
+	return item
+}
+
+// Store an item in the cache under a new version and record it in the history,
+// purging the oldest items if the cache has grown to its configured size.
+// Items in lower priority tiers are purged first, oldest first within each
+// tier.  Pinned items are passed over; if too few unpinned items remain, the
+// purge stops short of its target.  If a value codec is configured, the item
+// is stored encoded; an item which fails to encode is not stored, and removes
+// any earlier item for the key.  If an eviction chunk size is configured, the
+// lock is released and reacquired between chunks of the purge.  Returns the
+// purged items.  The caller must hold CacheLock for writing.
+func storeItem(c *readcache, cfg *Config, key string, item *cacheable) (evicted []evictedItem) {
+	c.LastVersion++
+	item.Version = c.LastVersion
+	item.Generation = c.Generation.Load()
+	if cfg.TrackKeyAccess && item.Accesses == nil {
+		item.Accesses = new(atomic.Uint64)
+	}
+	if cfg.RefetchSampling > 1 {
+		item.StaleHits = new(atomic.Uint64)
+	}
+	if cfg.EvictionPolicy != PolicyFIFO && item.Use == nil {
+		item.Use = new(itemUse)
+		if prev, ok := c.Cache[key]; ok && prev.Use != nil {
+			item.Use = prev.Use
+		}
+	}
+	recordUse(c, cfg, item)
+	if cfg.MonotonicExpiry {
+		item.FetchedAt = cfg.Clock.Now()
+		item.TTL = item.ExpiresAt.Sub(item.FetchedAt)
+	}
+	if cfg.HistoryDepth > 0 {
+		var history []HistoricalValue
+		if prev, ok := c.Cache[key]; ok {
+			history = slices.Clip(prev.History)
+		}
+		history = append(history, HistoricalValue{item.Value, cfg.Clock.Now()})
+		item.History = history[max(len(history)-cfg.HistoryDepth, 0):]
+	}
+	stored, err := encodeItem(cfg, item)
+	if err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.Warn("readcache: item could not be encoded", "key", key, "error", err)
+		}
+		if prev, ok := c.Cache[key]; ok {
+			deleteItem(c, key)
+			evicted = append(evicted, evictedItem{key, prev, EvictionDeleted})
+		}
+		return
+	}
+	forgetInterned(c, key)
+	c.Cache[key] = weakenItem(cfg, stored)
+	c.Guard.add(key)
+
+	c.Additions.PushFront(key)
+	c.AdditionCount++
+
+	if cfg.PurgeAt > 0 && c.AdditionCount >= cfg.PurgeAt {
+		dropStalePinnedAdditions(c)
+		for {
+			removeCount := c.AdditionCount - cfg.PurgeTo
+			if cfg.EvictionChunkSize > 0 {
+				removeCount = min(removeCount, cfg.EvictionChunkSize)
+			}
+			additionCount := c.AdditionCount
+			evicted = append(evicted, purge(c, cfg, removeCount)...)
+			if cfg.EvictionChunkSize <= 0 || c.AdditionCount == additionCount || c.AdditionCount <= cfg.PurgeTo {
+				break
+			}
+			// Let readers in between chunks.
+			c.CacheLock.Unlock()
+			runHook(c, hookPurgeChunk, key)
+			c.CacheLock.Lock()
+		}
+	}
+	return
+}
+
+// Remove the additions of pinned keys which have been added again since, so
+// that a pinned key, which is never purged, holds a single addition however
+// often it is stored.  The caller must hold CacheLock for writing.
+func dropStalePinnedAdditions(c *readcache) {
+	if len(c.Pinned) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for element := c.Additions.Front(); element != nil; {
+		next := element.Next()
+		if key := element.Value.(string); c.Pinned[key] {
+			if seen[key] {
+				c.Additions.Remove(element)
+				c.AdditionCount--
+			}
+			seen[key] = true
+		}
+		element = next
+	}
+}
+
+// Remove the item for a key from the cache, along with what is indexed by the
+// key.  The caller must hold CacheLock for writing.
+func deleteItem(c *readcache, key string) {
+	delete(c.Cache, key)
+	forgetInterned(c, key)
+}
+
+// Purge up to the given number of items, in the order of their priority tiers
+// and the eviction policy.  Pinned items are passed over.  Returns the purged
+// items.  The caller must hold CacheLock for writing.
+func purge(c *readcache, cfg *Config, removeCount int) (evicted []evictedItem) {
+	order := purgeOrder(c, cfg)
+	for _, tier := range purgeTiers(cfg) {
+		for i := 0; removeCount > 0 && i < len(order); i++ {
+			removeItem := order[i]
+			if removeItem == nil {
+				continue
+			}
+			removeKey := removeItem.Value.(string)
+			if c.Pinned[removeKey] || priorityTier(cfg, removeKey) != tier {
+				continue
+			}
+
+			if removed, ok := c.Cache[removeKey]; ok {
+				deleteItem(c, removeKey)
+				forgetDependencies(c, removeKey)
+				evicted = append(evicted, evictedItem{removeKey, removed, EvictionCapacity})
+			}
+
+			c.Additions.Remove(removeItem)
+			c.AdditionCount--
+			order[i] = nil
+			removeCount--
+		}
+	}
+	return
+}
+
+// FirstWriteWins is a conflict resolver which keeps the existing item; see
+// SetConflictResolver.
+func FirstWriteWins(key string, existing, incoming SnapshotEntry) SnapshotEntry {
+	return existing
+}
+
+// LastWriteWins is a conflict resolver which stores the fetched item, as is
+// done when no resolver is configured; see SetConflictResolver.
+func LastWriteWins(key string, existing, incoming SnapshotEntry) SnapshotEntry {
+	return incoming
+}
+
+// Determine the eviction priority tier of a key.
+func priorityTier(cfg *Config, key string) int {
+	tier, _ := longestPrefixMatch(cfg.PriorityTiers, key)
+	return tier
+}
+
+// List the configured eviction priority tiers, including the default tier of
+// zero, in the order in which they are purged.
+func purgeTiers(cfg *Config) []int {
+	tiers := []int{0}
+	for _, tier := range cfg.PriorityTiers {
+		if !slices.Contains(tiers, tier) {
+			tiers = append(tiers, tier)
+		}
+	}
+	slices.Sort(tiers)
+	return tiers
+}
+
+// Count a cache hit in the stats.
+func countHit(c *readcache, stale bool) {
+	if stale {
+		c.StaleHits.Add(1)
+	} else {
+		c.FreshHits.Add(1)
+	}
+}
+
+// Log and report a cache hit.
+func notifyHit(c *readcache, cfg *Config, key string) {
+	c.Events.record(cfg.EventBuffer, observedEvent{Kind: eventHit, Key: key})
+	if cfg.Logger != nil {
+		cfg.Logger.Debug("readcache: hit", "key", key)
+	}
+	for _, observer := range cfg.Observers {
+		observer.OnHit(key)
+	}
+}
+
+// Log and report a cache miss.
+func notifyMiss(c *readcache, cfg *Config, key string) {
+	c.Events.record(cfg.EventBuffer, observedEvent{Kind: eventMiss, Key: key})
+	if cfg.Logger != nil {
+		cfg.Logger.Debug("readcache: miss", "key", key)
+	}
+	for _, observer := range cfg.Observers {
+		observer.OnMiss(key)
+	}
 }
 
-func (c *readcache) SetPurgeAt(purgeAt int) {
-	c.PurgeAt = purgeAt
+// Log and report the completion of a fetch.
+func notifyFetch(c *readcache, cfg *Config, key string, duration time.Duration, err error) {
+	c.Events.record(cfg.EventBuffer, observedEvent{Kind: eventFetch, Key: key, Duration: duration, Error: err})
+	if cfg.Logger != nil {
+		if err == nil {
+			cfg.Logger.Debug("readcache: fetched", "key", key, "duration", duration)
+		} else {
+			cfg.Logger.Warn("readcache: fetch failed", "key", key, "duration", duration, "error", err)
+		}
+	}
+	for _, observer := range cfg.Observers {
+		observer.OnFetch(key, duration, err)
+	}
 }
 
-func (c *readcache) SetPurgeTo(purgeTo int) {
-	c.PurgeTo = purgeTo
+// Log and report the removal of the given items.  This is done once the cache
+// lock has been released, so that a slow callback cannot stall other goroutines.
+func notifyEvictions(c *readcache, cfg *Config, evicted []evictedItem) {
+	if len(evicted) == 0 {
+		return
+	}
+	for _, e := range evicted {
+		c.Events.record(cfg.EventBuffer, observedEvent{Kind: eventEvict, Key: e.Key, Reason: e.Reason})
+		if cfg.Logger != nil {
+			cfg.Logger.Debug("readcache: evicted", "key", e.Key, "reason", e.Reason.String())
+		}
+		if e.Reason == EvictionCapacity {
+			spillItem(c, cfg, e.Key, e.Item)
+		}
+		if cfg.OnEvict != nil && cfg.EvictWorkers > 0 {
+			c.EvictCallbacks.enqueue(cfg, &evictCallback{cfg.OnEvict, e.Key, e.Item, e.Reason})
+		} else if cfg.OnEvict != nil {
+			cfg.OnEvict(e.Key, decodedValue(e.Item), e.Reason)
+		}
+		for _, observer := range cfg.Observers {
+			observer.OnEvict(e.Key, e.Reason)
+		}
+	}
 }
 
 // Attempt to retrieve an item from the cache, if it exists and hasn't expired.
 // Returns somevalue, true if exists or nil, false if it does not.
-func getFromCache(c *readcache, key string) (*cacheable, bool) {
+func getFromCache(c *readcache, cfg *Config, key string) (cachedValue *cacheable, ok bool, stale bool) {
 	c.CacheLock.RLock()
-	cachedValue, ok := c.Cache[key]
+	cachedValue, ok = c.Cache[key]
 	c.CacheLock.RUnlock()
+	if ok && (discardReclaimed(c, cfg, key, cachedValue) || invalidate(c, cfg, key, cachedValue)) {
+		return nil, false, false
+	}
 	if ok {
-		now := time.Now()
-		if cachedValue.ExpiresAt.After(now) {
-			return cachedValue, true
+		now := cfg.Clock.Now()
+		expiresAt := expiryTime(c, cfg, cachedValue, now)
+		if expiresAt.After(now) {
+			countAccess(c, cfg, cachedValue)
+			return updateExpiration(c, cfg, key, cachedValue, now), true, false
+		}
+		if cfg.RefetchSampling > 1 || expiresAt.Add(cfg.StaleWhileRevalidate).After(now) {
+			countAccess(c, cfg, cachedValue)
+			return cachedValue, true, true
 		}
 		c.CacheLock.Lock()
 		// Determine if another goroutine has updated the cache before the lock
 		cachedValue, ok = c.Cache[key]
-		if ok && cachedValue.ExpiresAt.After(now) {
+		if ok && expiryTime(c, cfg, cachedValue, now).After(now) {
 			c.CacheLock.Unlock()
-			return cachedValue, true
+			countAccess(c, cfg, cachedValue)
+			return updateExpiration(c, cfg, key, cachedValue, now), true, false
 		}
-		delete(c.Cache, key)
+		deleteItem(c, key)
 		c.CacheLock.Unlock()
+		if ok {
+			notifyEvictions(c, cfg, []evictedItem{{key, cachedValue, EvictionExpired}})
+		}
+	}
+	return nil, false, false
+}
+
+// Remove an item found in the cache if the configured validator rejects it,
+// unless another goroutine has replaced it in the meantime.  Reports whether
+// the item was rejected.
+func invalidate(c *readcache, cfg *Config, key string, cachedValue *cacheable) bool {
+	if cfg.Validator == nil || cfg.Validator(key, decodedValue(cachedValue)) {
+		return false
+	}
+	c.CacheLock.Lock()
+	removed := c.Cache[key] == cachedValue
+	if removed {
+		deleteItem(c, key)
+	}
+	c.CacheLock.Unlock()
+	if removed {
+		notifyEvictions(c, cfg, []evictedItem{{key, cachedValue, EvictionInvalid}})
+	}
+	return true
+}
+
+// Start fetching an item in the background, so that an expired item which is
+// still being served is replaced.  If the item is already being fetched, that
+// fetch serves as the refresh.  The refresh's read control is registered for
+// the key, so Gets which miss meanwhile join it rather than fetching again.
+// If too many fetches are in flight, the refresh is skipped, to be tried
+// again on a later hit.  Returns the read control of the refresh, or nil if
+// none was started.
+func refresh(c *readcache, cfg *Config, key string) *readControl {
+	c.ReadControlsLock.Lock()
+	if _, ok := c.ReadControls[key]; ok {
+		c.ReadControlsLock.Unlock()
+		return nil
+	}
+	if cfg.MaxInFlightFetches > 0 && len(c.ReadControls) >= cfg.MaxInFlightFetches {
+		c.ReadControlsLock.Unlock()
+		return nil
+	}
+	control := newReadControl(false)
+	c.ReadControls[key] = control
+	c.ReadControlsLock.Unlock()
+	c.BackgroundRefreshes.Add(1)
+
+	go func() {
+		cachedValue, err := doFetch(c, cfg, key, control, nil, 0)
+		if cfg.OnRefresh != nil {
+			var value interface{}
+			if cachedValue != nil {
+				value = cachedValue.Value
+			}
+			cfg.OnRefresh(key, value, err)
+		}
+	}()
+	return control
+}
+
+// Decide whether a hit on an expired item is to refresh it.  If refetches are
+// sampled, only every nth hit on the item is.
+func sampleRefetch(cfg *Config, cachedValue *cacheable) bool {
+	if cfg.RefetchSampling <= 1 || cachedValue.StaleHits == nil {
+		return true
+	}
+	return cachedValue.StaleHits.Add(1)%uint64(cfg.RefetchSampling) == 0
+}
+
+// Count an access to an item which was found in the cache, if key access
+// tracking is enabled, and record it as a use for the eviction policy.
+func countAccess(c *readcache, cfg *Config, cachedValue *cacheable) {
+	if cfg.TrackKeyAccess && cachedValue.Accesses != nil {
+		cachedValue.Accesses.Add(1)
+	}
+	recordUse(c, cfg, cachedValue)
+}
+
+// Reset the expiration time of an unexpired item which was found in the
+// cache, if expiration is sliding, then let the on-hit expiry function, if
+// there is one, adjust it.  Items are never modified once cached, so if the
+// expiration time changes the item is replaced by an updated copy, unless
+// another goroutine has replaced it in the meantime.
+func updateExpiration(c *readcache, cfg *Config, key string, cachedValue *cacheable, now time.Time) *cacheable {
+	if cfg.SlidingExpiration <= 0 && cfg.OnHitExpiry == nil {
+		return cachedValue
+	}
+	current := expiryTime(c, cfg, cachedValue, now)
+	expiresAt := current
+	if cfg.SlidingExpiration > 0 {
+		expiresAt = now.Add(cfg.SlidingExpiration)
+	}
+	if cfg.OnHitExpiry != nil {
+		expiresAt = cfg.OnHitExpiry(key, decodedValue(cachedValue), expiresAt)
+	}
+	if expiresAt.Equal(current) {
+		return cachedValue
+	}
+	updated, _ := replaceExpiration(c, key, cachedValue, expiresAt, now)
+	return updated
+}
+
+// Replace a cached item by a copy expiring at the given time, unless another
+// goroutine has replaced it in the meantime.  An item whose expiry is measured
+// from its fetch, see SetMonotonicExpiry, is measured from now instead.
+// Returns the copy, and whether it replaced the item.
+func replaceExpiration(c *readcache, key string, cachedValue *cacheable, expiresAt time.Time, now time.Time) (*cacheable, bool) {
+	updated := *cachedValue
+	updated.ExpiresAt = expiresAt
+	if !updated.FetchedAt.IsZero() {
+		updated.FetchedAt, updated.TTL = now, expiresAt.Sub(now)
+	}
+
+	c.CacheLock.Lock()
+	defer c.CacheLock.Unlock()
+	if c.Cache[key] != cachedValue {
+		return &updated, false
 	}
-	return nil, false
+	c.Cache[key] = &updated
+	return &updated, true
 }
 
 // Get a Once for controlling the read-through on a particular cached item.
 // Performs a last-minute check to determine if another goroutine has populated
 // the cache before a lock is acquired, so this function may return a cached
 // value instead.  If so, the third return value will be true.  Otherwise, a
-// read control is returned and the third value is false.
-func getReadControl(c *readcache, key string) (control *readControl, cachedItem *cacheable, gotCachedItem bool) {
+// read control is returned and the third value is false.  If the configured
+// number of in-flight fetches has been reached, this either waits for one to
+// complete or returns ErrTooManyInFlight, as configured.  If the existing
+// read control for the key already has as many waiters as may share it, an
+// overflow read control replaces it, so that later callers share a second
+// fetch.  If the cache is not to be checked, a read control is returned even
+// if the item is cached.  The fourth value reports whether the read control
+// was joined, rather than created for this call.
+func getReadControl(c *readcache, cfg *Config, key string, checkCache bool) (control *readControl, cachedItem *cacheable, gotCachedItem bool, joined bool, err error) {
 	gotCachedItem = false
 
 	c.ReadControlsLock.RLock()
 	control, ok := c.ReadControls[key]
 	c.ReadControlsLock.RUnlock()
-	if !ok {
+	joined = ok && !overCoalesced(cfg, control)
+	if joined {
+		control.Waiters.Add(1)
+	} else {
 		c.ReadControlsLock.Lock()
+		for {
+			// Another goroutine may have created a read control, fetched an item, updated the
+			// cache and cleaned up its read control by the time we reach this point.
+			// Therefore, we verify that the cache still does not contain anything for the
+			// given key.
+			// Warning: possibility of deadlock when dealing with multiple locks.  Make sure
+			//          they are always acquired in the same order.
+			if checkCache {
+				c.CacheLock.RLock()
+				cachedItem, ok = c.Cache[key]
+				c.CacheLock.RUnlock()
 
-		// Another goroutine may have created a read control, fetched an item, updated the
-		// cache and cleaned up its read control by the time we reach this point.
-		// Therefore, we verify that the cache still does not contain anything for the
-		// given key.
-		// Warning: possibility of deadlock when dealing with multiple locks.  Make sure
-		//          they are always acquired in the same order.
-		c.CacheLock.RLock()
-		cachedItem, ok = c.Cache[key]
-		c.CacheLock.RUnlock()
-
-		if ok {
-			c.ReadControlsLock.Unlock()
-			gotCachedItem = true
-			return
-		}
+				if ok && !reclaimed(cachedItem) {
+					c.ReadControlsLock.Unlock()
+					gotCachedItem = true
+					return
+				}
+			}
 
-		control, ok = c.ReadControls[key]
-		if !ok {
-			control = &readControl{new(sync.Once), nil, nil}
-			c.ReadControls[key] = control
+			existing, ok := c.ReadControls[key]
+			if ok && !overCoalesced(cfg, existing) {
+				control = existing
+				control.Waiters.Add(1)
+				joined = true
+				break
+			}
+			if ok || cfg.MaxInFlightFetches <= 0 || len(c.ReadControls) < cfg.MaxInFlightFetches {
+				control = newReadControl(ok)
+				c.ReadControls[key] = control
+				break
+			}
+			if !cfg.BlockExcessFetches {
+				c.ReadControlsLock.Unlock()
+				return nil, nil, false, false, ErrTooManyInFlight
+			}
+			c.ReadControlsFreed.Wait()
 		}
 		c.ReadControlsLock.Unlock()
 	}
+	if joined {
+		runHook(c, hookJoin, key)
+	}
 
 	return
 }
 
+// Decide which item to store for a fetch, if the item for its key has been
+// stored by a concurrent write since the given version.  The caller must hold
+// CacheLock for writing.
+func resolveConflict(c *readcache, cfg *Config, key string, incoming *cacheable, startVersion uint64) *cacheable {
+	existing, ok := c.Cache[key]
+	if !ok || existing.Version <= startVersion {
+		return incoming
+	}
+	resolved := cfg.ConflictResolver(key,
+		SnapshotEntry{decodedValue(existing), existing.ExpiresAt},
+		SnapshotEntry{incoming.Value, incoming.ExpiresAt})
+	return newItem(cfg, resolved.Value, resolved.ExpiresAt)
+}
+
+// Determine whether a read control has as many waiters as may share it.  An
+// overflow read control is never itself split, so that a key has at most two
+// fetches in flight.
+func overCoalesced(cfg *Config, control *readControl) bool {
+	return cfg.MaxCoalescedWaiters > 0 && !control.Overflow && control.Waiters.Load() >= int64(cfg.MaxCoalescedWaiters)
+}
+
 // Use the given read control to fetch a value and store it in the cache.
 // The read control may prevent this goroutine from fetching the value if
 // some other routine gets to it first.  In either case, the resulting
-// fetched value is returned.
-func doFetch(c *readcache, key string, readControl *readControl) (cachedValue *cacheable, err error) {
+// fetched value is returned.  The value is fetched with the given getter,
+// or with the configured getter if it is nil, once a fetch slot has been
+// granted at the given priority.  A fetch uses the settings it
+// started with throughout, even if the cache is reconfigured meanwhile.
+// Observers and the eviction callback are notified once the fetch has
+// completed, so that they may fetch the same key in turn.
+func doFetch(c *readcache, cfg *Config, key string, readControl *readControl, getter func(string) (interface{}, time.Time, error), priority int) (cachedValue *cacheable, err error) {
+	var notifications []func()
 	readControl.Controller.Do(func() {
+		runHook(c, hookFetch, key)
 		defer func() {
 			c.ReadControlsLock.Lock()
-			delete(c.ReadControls, key)
+			// An overflow read control may have replaced this one.
+			if c.ReadControls[key] == readControl {
+				delete(c.ReadControls, key)
+			}
+			c.ReadControlsFreed.Broadcast()
 			c.ReadControlsLock.Unlock()
+			readControl.Cancel()
+			close(readControl.Done)
 		}()
 
-		var value interface{}
-		var expiresAt time.Time
-		value, expiresAt, err = c.Getter(key)
-		if err == nil {
-			cachedValue = &cacheable{value, expiresAt}
+		if cachedValue, source, ok := loadFromStores(cfg, key); ok {
 			readControl.Result = cachedValue
+			readControl.Source = source
 			c.CacheLock.Lock()
-			c.Cache[key] = cachedValue
+			evicted := storeItem(c, cfg, key, cachedValue)
 			c.CacheLock.Unlock()
+			notifications = append(notifications, func() { notifyEvictions(c, cfg, evicted) })
+			c.Watchers.send(key, cachedValue.Value)
+			return
+		}
+
+		// Only the configured item fetcher is guarded by the circuit breaker.
+		primary := getter == nil
+		if getter == nil && cfg.ContextGetter != nil {
+			getter = func(key string) (interface{}, time.Time, error) {
+				return cfg.ContextGetter(readControl.Context, key)
+			}
+		}
+		if getter == nil && cfg.FanOutGetter != nil {
+			getter = fanOutGetter(c, cfg, cfg.FanOutGetter)
+		}
+		if getter == nil {
+			getter = cfg.Getter
+		}
+		if getter == nil {
+			readControl.Error = ErrNoGetter
+			return
+		}
+		if primary && cfg.CircuitOpenFallback != nil && c.Breaker.isOpen(cfg, cfg.Clock.Now()) {
+			if value, ok := cfg.CircuitOpenFallback(key); ok {
+				readControl.Result = newItem(cfg, value, time.Time{})
+				readControl.Source = SourceFallback
+				return
+			}
+		}
+
+		// Items stored after this version are stored by concurrent writes.
+		var startVersion uint64
+		if cfg.ConflictResolver != nil {
+			c.CacheLock.RLock()
+			startVersion = c.LastVersion
+			c.CacheLock.RUnlock()
+		}
 
-			c.History.PushFront(key)
-			c.HistoryCount++
-
-			if c.PurgeAt > 0 && c.HistoryCount >= c.PurgeAt {
-				c.CacheLock.Lock()
-				removeCount := c.HistoryCount - c.PurgeTo
-				removeItem := c.History.Back()
-				for i := 0; i < removeCount && removeItem != nil; i++ {
-					removeKey := removeItem.Value.(string)
-					delete(c.Cache, removeKey)
-
-					nextItem := removeItem.Prev()
-					c.History.Remove(removeItem)
-					c.HistoryCount--
-					removeItem = nextItem
+		var value interface{}
+		var expiresAt time.Time
+		release := c.FetchSlots.acquire(cfg.MaxConcurrentFetches, priority, key)
+		start := time.Now()
+		if primary && c.Breaker.isOpen(cfg, cfg.Clock.Now()) {
+			err = ErrBackendUnavailable
+		} else if primary && c.Guard.rejects(key) {
+			err = ErrNotFound
+		} else {
+			if primary {
+				var result hedgedResult
+				result, release = hedgedFetch(c, cfg, getter, key, release)
+				value, expiresAt, err = result.Value, result.ExpiresAt, result.Err
+			} else {
+				value, expiresAt, err = getter(key)
+			}
+			duration, fetchErr := time.Since(start), err
+			notifications = append(notifications, func() { notifyFetch(c, cfg, key, duration, fetchErr) })
+			if err != nil {
+				err = &FetchError{key, err}
+			}
+			if primary {
+				// A key which does not exist is no failure of the fetcher.
+				notFound := errors.Is(err, ErrNotFound)
+				if !notFound {
+					c.Breaker.record(cfg, cfg.Clock.Now(), err)
 				}
+				c.Guard.record(notFound)
+			}
+		}
+		readControl.Source = SourcePrimary
+		if err != nil && cfg.FallbackGetter != nil {
+			fallbackStart := time.Now()
+			fallbackValue, fallbackExpiresAt, fallbackErr := cfg.FallbackGetter(key)
+			fallbackDuration := time.Since(fallbackStart)
+			notifications = append(notifications, func() { notifyFetch(c, cfg, key, fallbackDuration, fallbackErr) })
+			if fallbackErr == nil {
+				value, expiresAt, err = fallbackValue, fallbackExpiresAt, nil
+				readControl.Source = SourceFallback
+			}
+		}
+		release()
+		elapsed := time.Since(start)
+		readControl.Elapsed = elapsed
+		if err == nil {
+			if ttl, ok := prefixTTL(cfg, key); ok && expiresAt.IsZero() {
+				expiresAt = cfg.Clock.Now().Add(ttl)
+			}
+			if expiresAt.IsZero() && cfg.CostBasedTTL != nil {
+				expiresAt = cfg.Clock.Now().Add(cfg.CostBasedTTL(elapsed))
+			}
+			if cfg.TTLOverride != nil {
+				expiresAt = cfg.TTLOverride(key, value, expiresAt)
+			}
+			if reuseUntil := cfg.Clock.Now().Add(cfg.MinResultReuse); cfg.MinResultReuse > 0 && expiresAt.Before(reuseUntil) {
+				expiresAt = reuseUntil
+			}
+		}
+		cache := true
+		if err == nil {
+			expiresAt, cache, err = checkExpiry(cfg, key, expiresAt)
+		}
+		if err == nil {
+			cachedValue = newItem(cfg, value, expiresAt)
+			readControl.Result = cachedValue
+			if !cache || value == nil && !cfg.CacheNilValues {
+				return
+			}
+			if cfg.CachePredicate != nil && !cfg.CachePredicate(key, value) {
+				return
+			}
+			if oversized(cfg, key, value) {
+				c.OversizedRejected.Add(1)
+				return
+			}
+			c.CacheLock.Lock()
+			if readControl.Context.Err() != nil {
 				c.CacheLock.Unlock()
+				return
+			}
+			index, interned := internValue(c, cfg, key, cachedValue)
+			fetched := cachedValue
+			if cfg.ConflictResolver != nil {
+				cachedValue = resolveConflict(c, cfg, key, cachedValue, startVersion)
+				readControl.Result = cachedValue
+			}
+			evicted := storeItem(c, cfg, key, cachedValue)
+			if interned && cachedValue == fetched {
+				indexInterned(c, key, index)
 			}
+			c.CacheLock.Unlock()
+			notifications = append(notifications, func() { notifyEvictions(c, cfg, evicted) })
+			storeToL2(c, cfg, key, cachedValue)
+			c.Watchers.send(key, cachedValue.Value)
 		} else {
+			if cfg.ErrorBackoff > 0 && err != ErrBackendUnavailable && readControl.Context.Err() == nil {
+				until := cfg.Clock.Now()
+				if expiresAt.After(until) {
+					until = expiresAt
+				} else {
+					until = until.Add(backoffDuration(cfg))
+				}
+				c.ErrorBackoffs.add(key, err, until, cfg.MaxNegativeEntries)
+			}
 			readControl.Error = err
 		}
 	})
+	for _, notify := range notifications {
+		notify()
+	}
 
 	cachedValue = readControl.Result
 	err = readControl.Error
@@ -1,9 +1,14 @@
 package readcache
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -152,6 +157,155 @@ func TestGet_ErrorInGetter_ConcurrentReads_ShouldReturnError(t *testing.T) {
 	}
 }
 
+func TestGetSourced_ShouldReportPrimaryThenCache(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	if _, source, _ := cache.GetSourced("key"); source != SourcePrimary {
+		t.Errorf("Expected the first Get to come from the primary fetcher, but got %s", source)
+	}
+	if _, source, _ := cache.GetSourced("key"); source != SourceCache {
+		t.Errorf("Expected the second Get to come from the cache, but got %s", source)
+	}
+}
+
+func TestGetSourced_WithL2_ShouldReportL2(t *testing.T) {
+	l2 := newMapL2()
+	l2.Store("key", "from l2", time.Now().Add(100e9))
+	cache := New(newGetter("foo", 100e9))
+	cache.SetL2(l2)
+	result, source, _ := cache.GetSourced("key")
+	if result != "from l2" || source != SourceL2 {
+		t.Errorf("Expected 'from l2' from the L2 store but got %v from %s", result, source)
+	}
+}
+
+func TestGetSourced_WithFallback_ErrorInGetter_ShouldReportFallback(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetFallbackGetter(newGetter("fallback", 100e9))
+	result, source, err := cache.GetSourced("key")
+	if result != "fallback" || source != SourceFallback || err != nil {
+		t.Errorf("Expected 'fallback' from the fallback but got %v from %s, %v", result, source, err)
+	}
+}
+
+func TestGet_WithFallback_ErrorInBoth_ShouldReturnPrimaryError(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Error message")
+	}
+	fallback := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Fallback error")
+	}
+	cache := New(getter)
+	cache.SetFallbackGetter(fallback)
+	if _, err := cache.Get("key"); err == nil || err.Error() != "Error message" {
+		t.Errorf("Expected 'Error message' but got %v", err)
+	}
+}
+
+func TestGetBefore_StaggeredDeadlinesOverSlowFetch_ShouldTimeOutEarlyCallers(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount++
+		fetchLock.Unlock()
+		time.Sleep(200 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	start := time.Now()
+	results := make(chan error, 3)
+	for _, wait := range []time.Duration{20 * time.Millisecond, 50 * time.Millisecond, 5 * time.Second} {
+		deadline := start.Add(wait)
+		go func() {
+			_, err := cache.GetBefore("key", deadline)
+			results <- err
+		}()
+	}
+
+	timeouts := 0
+	for i := 0; i < 3; i++ {
+		err := <-results
+		if err == ErrTimeout {
+			timeouts++
+		} else if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+		}
+	}
+	if timeouts != 2 {
+		t.Errorf("Expected 2 callers to time out but got %d", timeouts)
+	}
+	if result, _ := cache.Get("key"); result != "foo" {
+		t.Errorf("Expected the fetch to complete and be cached, but got %v", result)
+	}
+	if fetchCount != 1 {
+		t.Errorf("Should have only fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGet_GetterError_ShouldWrapInFetchError(t *testing.T) {
+	getterErr := errors.New("backend failure")
+	cache := New(func(key string) (interface{}, time.Time, error) {
+		return nil, time.Time{}, getterErr
+	})
+
+	_, err := cache.Get("key")
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.Key != "key" {
+		t.Fatalf("Expected a FetchError for key but got %#v", err)
+	}
+	if !errors.Is(err, getterErr) || err.Error() != getterErr.Error() {
+		t.Errorf("Expected the getter's error to be wrapped but got %v", err)
+	}
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the getter's error not to be taken for the cache's own but got %v", err)
+	}
+}
+
+func TestGetBefore_Timeout_ShouldNotBeFetchError(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	cache := New(func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	})
+
+	_, err := cache.GetBefore("key", time.Now().Add(10*time.Millisecond))
+	var fetchErr *FetchError
+	if !errors.Is(err, ErrTimeout) || errors.As(err, &fetchErr) {
+		t.Errorf("Expected ErrTimeout rather than a FetchError but got %#v", err)
+	}
+}
+
+func TestGet_WithCircuitBreaker_Open_ShouldNotBeFetchError(t *testing.T) {
+	cache := New(func(key string) (interface{}, time.Time, error) {
+		return nil, time.Time{}, errors.New("backend down")
+	})
+	cache.SetCircuitBreaker(1, time.Minute)
+	_, first := cache.Get("first")
+	_, second := cache.Get("second")
+
+	var fetchErr *FetchError
+	if !errors.As(first, &fetchErr) || fetchErr.Key != "first" {
+		t.Errorf("Expected the failure which opened the breaker to be a FetchError but got %#v", first)
+	}
+	if !errors.Is(second, ErrCircuitOpen) || errors.As(second, &fetchErr) {
+		t.Errorf("Expected ErrCircuitOpen rather than a FetchError but got %#v", second)
+	}
+}
+
+func TestGetBefore_WithCachedItem_ShouldReturnValue(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	result, err := cache.GetBefore("key", time.Now())
+	if err != nil || result != "foo" {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+}
+
 func TestGet_WithPurgeRules_ShouldPurgeOldEntries(t *testing.T) {
 	fetchCount := 0
 	getter := func(key string) (interface{}, time.Time, error) {
@@ -164,28 +318,2077 @@ func TestGet_WithPurgeRules_ShouldPurgeOldEntries(t *testing.T) {
 
 	cache.Get("1")
 	cache.Get("2")
-	cache.Get("1")
-	cache.Get("2")
-	if fetchCount != 2 {
-		t.Errorf("Expected fetchCount = 2 but was %d", fetchCount)
+	cache.Get("1")
+	cache.Get("2")
+	if fetchCount != 2 {
+		t.Errorf("Expected fetchCount = 2 but was %d", fetchCount)
+	}
+	cache.Get("3") // {1, 2, 3} -> Purge -> {3}
+	cache.Get("3")
+	if fetchCount != 3 {
+		t.Errorf("Expected fetchCount = 3 but was %d", fetchCount)
+	}
+	cache.Get("1")
+	cache.Get("2") // {1, 2, 3} -> Purge -> {2}
+	if fetchCount != 5 {
+		t.Errorf("Expected fetchCount = 5 but was %d", fetchCount)
+	}
+	cache.Get("3")
+	if fetchCount != 6 {
+		t.Errorf("Expected fetchCount = 6 but was %d", fetchCount)
+	}
+	cache.Get("2")
+	if fetchCount != 6 {
+		t.Errorf("Expected fetchCount = 6 but was %d", fetchCount)
+	}
+}
+
+func TestGet_Twice_WithNilValue_ShouldNotFetchTwice(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Get("key")
+	cache.Get("key")
+	if fetchCount != 1 {
+		t.Errorf("Should have only fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGet_Twice_WithNilValue_WithoutCachingNil_ShouldFetchTwice(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return nil, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetCacheNilValues(false)
+	for i := 0; i < 2; i++ {
+		result, err := cache.Get("key")
+		if result != nil || err != nil {
+			t.Errorf("Expected nil, nil but got %v, %v", result, err)
+		}
+	}
+	if fetchCount != 2 {
+		t.Errorf("Should have fetched twice, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithCachePredicate_RejectingEmptySlices_ShouldReturnButRefetch(t *testing.T) {
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount[key]++
+		if key == "empty" {
+			return []string{}, time.Now().Add(100e9), nil
+		}
+		return []string{"foo"}, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetCachePredicate(func(key string, value interface{}) bool {
+		return len(value.([]string)) > 0
+	})
+	for i := 0; i < 2; i++ {
+		if result, err := cache.Get("empty"); len(result.([]string)) != 0 || err != nil {
+			t.Errorf("Expected an empty result but got %v, %v", result, err)
+		}
+		if result, err := cache.Get("full"); len(result.([]string)) != 1 || err != nil {
+			t.Errorf("Expected [foo] but got %v, %v", result, err)
+		}
+	}
+	if fetchCount["empty"] != 2 || fetchCount["full"] != 1 {
+		t.Errorf("Expected the empty result to be fetched twice and the full one once, but got %v", fetchCount)
+	}
+}
+
+func TestGet_WithMaxEntryBytes_OversizedValue_ShouldReturnButNotCache(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "huge" {
+			return make([]byte, 1000), time.Now().Add(100e9), nil
+		}
+		return make([]byte, 10), time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetSizer(func(value interface{}) int64 { return int64(len(value.([]byte))) })
+	cache.SetMaxEntryBytes(100)
+
+	result, err := cache.Get("huge")
+	if bytes, _ := result.([]byte); len(bytes) != 1000 || err != nil {
+		t.Errorf("Expected the oversized value to be returned but got %d bytes, %v", len(bytes), err)
+	}
+	cache.Get("small")
+	if status := cache.Status("huge"); status != StatusAbsent {
+		t.Errorf("Expected the oversized value not to be cached but got %s", status)
+	}
+	if status := cache.Status("small"); status != StatusFresh {
+		t.Errorf("Expected the small value to be cached but got %s", status)
+	}
+	if stats := cache.Stats(); stats.OversizedRejected != 1 {
+		t.Errorf("Expected 1 rejected value but got %d", stats.OversizedRejected)
+	}
+}
+
+func TestGet_Lazy_BeforeSetGetter_ShouldReturnErrNoGetter(t *testing.T) {
+	cache := NewLazy()
+	result, err := cache.Get("key")
+	if err != ErrNoGetter {
+		t.Errorf("Expected ErrNoGetter but got %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected no value but got %v", result)
+	}
+}
+
+func TestGet_Lazy_AfterSetGetter_ShouldReturnValue(t *testing.T) {
+	cache := NewLazy()
+	cache.Get("key")
+	cache.SetGetter(newGetter("foo", 100e9))
+	result, err := cache.Get("key")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+	if result != "foo" {
+		t.Errorf("Expected 'foo' but got %v", result)
+	}
+}
+
+func TestGet_Lazy_ConcurrentReadsBeforeSetGetter_ShouldAllReturnErrNoGetter(t *testing.T) {
+	cache := NewLazy()
+	quit := make(chan bool)
+	for r := 0; r < 16; r++ {
+		go func() {
+			for i := 0; i < 256; i++ {
+				if _, err := cache.Get(fmt.Sprintf("%d", i%8)); err != ErrNoGetter {
+					t.Errorf("Expected ErrNoGetter but got %v", err)
+				}
+			}
+			quit <- true
+		}()
+	}
+	for r := 0; r < 16; r++ {
+		<-quit
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected nothing to be cached but got %d entries", stats.Entries)
+	}
+}
+
+func TestGetVersioned_AfterRefresh_ShouldReturnLargerVersion(t *testing.T) {
+	expiresAt := time.Now().Add(-1)
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", expiresAt, nil
+	}
+	cache := New(getter)
+	_, first, _ := cache.GetVersioned("key")
+	_, second, _ := cache.GetVersioned("key")
+	if first == 0 {
+		t.Error("Expected a non-zero version")
+	}
+	if second <= first {
+		t.Errorf("Expected version %d to be larger than %d", second, first)
+	}
+}
+
+func TestGetVersioned_Twice_WithoutChange_ShouldReturnSameVersion(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	_, first, _ := cache.GetVersioned("key")
+	_, second, _ := cache.GetVersioned("key")
+	if first != second {
+		t.Errorf("Expected the same version but got %d and %d", first, second)
+	}
+}
+
+func TestSet_ShouldReplaceValueAndVersion(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	_, before, _ := cache.GetVersioned("key")
+	cache.Set("key", "bar", time.Now().Add(100e9))
+	result, after, _ := cache.GetVersioned("key")
+	if result != "bar" {
+		t.Errorf("Expected 'bar' but got %v", result)
+	}
+	if after <= before {
+		t.Errorf("Expected version %d to be larger than %d", after, before)
+	}
+}
+
+func TestSet_WithSuppressRedundantSet_EqualValue_ShouldOnlyExtendExpiry(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	published := 0
+	cache := NewLazy()
+	cache.SetClock(clock)
+	cache.SetEvictionPolicy(PolicyLRU)
+	cache.SetPurgeAt(3)
+	cache.SetPurgeTo(2)
+	cache.SetInvalidationPublisher(func(key string) { published++ })
+	cache.SetSuppressRedundantSet(func(a, b interface{}) bool { return a == b })
+	cache.Set("a", 1, clock.Now().Add(time.Minute))
+	cache.Set("b", 2, clock.Now().Add(time.Minute))
+
+	for i := 2; i <= 5; i++ {
+		cache.Set("a", 1, clock.Now().Add(time.Duration(i)*time.Minute))
+	}
+	if published != 2 {
+		t.Errorf("Expected no invalidations for equal values, but got %d in all", published)
+	}
+	if remaining, _ := cache.Remaining("a"); remaining != 5*time.Minute {
+		t.Errorf("Expected the expiry to be extended to 5m but got %v", remaining)
+	}
+
+	// The redundant sets leave a least recently used, so it is purged first.
+	cache.Set("c", 3, clock.Now().Add(time.Minute))
+	if status := cache.Status("a"); status != StatusAbsent {
+		t.Errorf("Expected a to be purged but got %s", status)
+	}
+	if status := cache.Status("b"); status != StatusFresh {
+		t.Errorf("Expected b to remain but got %s", status)
+	}
+}
+
+func TestSet_WithSuppressRedundantSet_MonotonicExpiryDisabledSince_ShouldExtendExpiry(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	cache := NewLazy()
+	cache.SetClock(clock)
+	cache.SetSuppressRedundantSet(func(a, b interface{}) bool { return a == b })
+	cache.SetMonotonicExpiry(true)
+	cache.Set("a", 1, clock.Now().Add(time.Minute))
+	cache.SetMonotonicExpiry(false)
+	cache.Set("a", 1, clock.Now().Add(time.Hour))
+
+	// The item keeps measuring its expiry from its fetch, as a hit would.
+	cache.SetMonotonicExpiry(true)
+	if remaining, _ := cache.Remaining("a"); remaining != time.Hour {
+		t.Errorf("Expected the expiry to be extended to 1h but got %v", remaining)
+	}
+}
+
+func TestSet_WithSuppressRedundantSet_ChangedValue_ShouldReplace(t *testing.T) {
+	published := 0
+	cache := NewLazy()
+	cache.SetInvalidationPublisher(func(key string) { published++ })
+	cache.SetSuppressRedundantSet(func(a, b interface{}) bool { return a == b })
+	cache.Set("key", "foo", time.Now().Add(100e9))
+	_, before, _ := cache.GetVersioned("key")
+	cache.Set("key", "bar", time.Now().Add(100e9))
+	result, after, _ := cache.GetVersioned("key")
+	if result != "bar" || after <= before || published != 2 {
+		t.Errorf("Expected bar under a new version, published, but got %v, %d after %d, %d published", result, after, before, published)
+	}
+}
+
+func TestSetIfVersion_WithCurrentVersion_ShouldStore(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	_, version, _ := cache.GetVersioned("key")
+	if !cache.SetIfVersion("key", "bar", time.Now().Add(100e9), version) {
+		t.Error("Expected the value to be stored")
+	}
+	if result, _ := cache.Get("key"); result != "bar" {
+		t.Errorf("Expected 'bar' but got %v", result)
+	}
+}
+
+func TestSetIfVersion_WithChangedVersion_ShouldNotStore(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	_, version, _ := cache.GetVersioned("key")
+	cache.Set("key", "changed underneath", time.Now().Add(100e9))
+	if cache.SetIfVersion("key", "bar", time.Now().Add(100e9), version) {
+		t.Error("Expected the value not to be stored")
+	}
+	if result, _ := cache.Get("key"); result != "changed underneath" {
+		t.Errorf("Expected 'changed underneath' but got %v", result)
+	}
+}
+
+func TestSetIfVersion_WithZeroVersionForAbsentKey_ShouldStore(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	if !cache.SetIfVersion("key", "bar", time.Now().Add(100e9), 0) {
+		t.Error("Expected the value to be stored")
+	}
+	if cache.SetIfVersion("key", "baz", time.Now().Add(100e9), 0) {
+		t.Error("Expected the value not to be stored once the key is present")
+	}
+}
+
+func TestReplace_PresentKey_ShouldStore(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	if !cache.Replace("key", "bar", time.Now().Add(100e9)) {
+		t.Error("Expected the value to be stored")
+	}
+	if result, _ := cache.Get("key"); result != "bar" {
+		t.Errorf("Expected 'bar' but got %v", result)
+	}
+}
+
+func TestReplace_AbsentKey_ShouldNotStore(t *testing.T) {
+	cache := NewLazy()
+	if cache.Replace("key", "bar", time.Now().Add(100e9)) {
+		t.Error("Expected the value not to be stored")
+	}
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected the key to remain absent but got %s", status)
+	}
+}
+
+func TestReplace_KeyTooLong_ShouldNotStore(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("long key")
+	cache.SetMaxKeyLength(3)
+	if cache.Replace("long key", "bar", time.Now().Add(100e9)) {
+		t.Error("Expected the value not to be stored")
+	}
+	cache.SetMaxKeyLength(0)
+	if result, _ := cache.Get("long key"); result != "foo" {
+		t.Errorf("Expected 'foo' but got %v", result)
+	}
+}
+
+func TestAdd_ConcurrentAdds_ShouldStoreExactlyOnce(t *testing.T) {
+	cache := NewLazy()
+	var wait sync.WaitGroup
+	stored := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			if cache.Add("key", i, time.Now().Add(100e9)) {
+				stored <- i
+			}
+		}(i)
+	}
+	wait.Wait()
+	close(stored)
+
+	if len(stored) != 1 {
+		t.Fatalf("Expected exactly one Add to succeed but got %d", len(stored))
+	}
+	winner := <-stored
+	if result, _ := cache.Get("key"); result != winner {
+		t.Errorf("Expected the winning value %d but got %v", winner, result)
+	}
+}
+
+func TestAdd_KeyBeingFetched_ShouldNotStore(t *testing.T) {
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	go cache.Get("key")
+	waitForReadControl(t, cache, "key")
+
+	if cache.Add("key", "bar", time.Now().Add(100e9)) {
+		t.Error("Expected the value not to be stored while the key is fetched")
+	}
+	close(unblock)
+}
+
+func TestGet_WithLogger_ShouldLogMissFetchAndHit(t *testing.T) {
+	handler := &recordingHandler{}
+	cache := New(newGetter("foo", 100e9))
+	cache.SetLogger(slog.New(handler))
+	cache.Get("key")
+	cache.Get("key")
+
+	expected := []string{"DEBUG readcache: miss", "DEBUG readcache: fetched", "DEBUG readcache: hit"}
+	records := handler.Records()
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, records)
+	}
+	for i, record := range records {
+		if got := record.Level.String() + " " + record.Message; got != expected[i] {
+			t.Errorf("Expected record %d to be '%s' but got '%s'", i, expected[i], got)
+		}
+		if key := recordAttr(record, "key"); key != "key" {
+			t.Errorf("Expected record %d to have key 'key' but got '%v'", i, key)
+		}
+	}
+	if recordAttr(records[1], "duration") == nil {
+		t.Error("Expected the fetch record to have a duration")
+	}
+}
+
+func TestGet_WithLogger_ErrorInGetter_ShouldLogWarning(t *testing.T) {
+	handler := &recordingHandler{}
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetLogger(slog.New(handler))
+	cache.Get("key")
+
+	records := handler.Records()
+	last := records[len(records)-1]
+	if last.Level != slog.LevelWarn || last.Message != "readcache: fetch failed" {
+		t.Errorf("Expected a fetch failure warning but got %s %s", last.Level, last.Message)
+	}
+	if err, ok := recordAttr(last, "error").(error); !ok || err.Error() != "Error message" {
+		t.Errorf("Expected the error to be logged but got %v", recordAttr(last, "error"))
+	}
+}
+
+func TestGet_WithLogger_WithPurgeRules_ShouldLogEvictions(t *testing.T) {
+	handler := &recordingHandler{}
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	cache.SetLogger(slog.New(handler))
+	cache.Get("1")
+	cache.Get("2")
+
+	evictions := 0
+	for _, record := range handler.Records() {
+		if record.Message == "readcache: evicted" && recordAttr(record, "key") == "1" {
+			evictions++
+		}
+	}
+	if evictions != 1 {
+		t.Errorf("Expected one eviction record for key '1' but got %d", evictions)
+	}
+}
+
+func TestGet_WithoutLogger_Hit_ShouldNotAllocate(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Get("key")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %v", allocs)
+	}
+}
+
+func TestGet_WithPrefixTTLs_ZeroExpiry_ShouldApplyLongestPrefix(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", time.Time{}, nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetPrefixTTL("config:", time.Hour)
+	cache.SetPrefixTTL("price:", 10*time.Second)
+	cache.SetPrefixTTL("price:live:", time.Second)
+
+	for key, ttl := range map[string]time.Duration{
+		"config:theme":  time.Hour,
+		"price:apple":   10 * time.Second,
+		"price:live:fx": time.Second,
+		"other":         0,
+	} {
+		cache.Get(key)
+		expected := clock.Now().Add(ttl)
+		if ttl == 0 {
+			expected = time.Time{}
+		}
+		if expiry := expiryOf(cache, key); !expiry.Equal(expected) {
+			t.Errorf("Expected %s to expire at %v but got %v", key, expected, expiry)
+		}
+	}
+}
+
+func TestGet_WithCostBasedTTL_SlowerFetch_ShouldGetLongerTTL(t *testing.T) {
+	latencies := map[string]time.Duration{"fast": time.Millisecond, "slow": 50 * time.Millisecond}
+	getter := func(key string) (interface{}, time.Time, error) {
+		time.Sleep(latencies[key])
+		return key, time.Time{}, nil
+	}
+	cache := New(getter)
+	cache.SetCostBasedTTL(func(fetchDuration time.Duration) time.Duration {
+		return fetchDuration * 1000
+	})
+	cache.Get("fast")
+	cache.Get("slow")
+
+	fast := expiryOf(cache, "fast")
+	slow := expiryOf(cache, "slow")
+	if !slow.After(fast) {
+		t.Errorf("Expected the slow item to expire after the fast one, but got %v and %v", slow, fast)
+	}
+	if ttl := time.Until(slow); ttl < 50*time.Second {
+		t.Errorf("Expected the slow item to live at least 50s but got %v", ttl)
+	}
+}
+
+func TestGet_WithCostBasedTTL_WithExplicitExpiry_ShouldKeepExpiry(t *testing.T) {
+	expiresAt := time.Now().Add(time.Minute)
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", expiresAt, nil
+	}
+	cache := New(getter)
+	cache.SetCostBasedTTL(func(time.Duration) time.Duration {
+		return time.Hour
+	})
+	cache.Get("key")
+	if got := expiryOf(cache, "key"); !got.Equal(expiresAt) {
+		t.Errorf("Expected the getter's expiry %v but got %v", expiresAt, got)
+	}
+}
+
+func TestDelete_ShouldRemoveItem(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	var reasons []EvictionReason
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		reasons = append(reasons, reason)
+	})
+	cache.Get("key")
+	cache.Delete("key")
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Expected the deleted item to be fetched again, but fetchCount was %d", fetchCount)
+	}
+	if len(reasons) != 1 || reasons[0] != EvictionDeleted {
+		t.Errorf("Expected a single deletion eviction but got %v", reasons)
+	}
+}
+
+func TestGetAndSet_ShouldReturnPreviousValue(t *testing.T) {
+	cache := NewLazy()
+	if prev, hadPrev := cache.GetAndSet("key", "foo", time.Now().Add(100e9)); prev != nil || hadPrev {
+		t.Errorf("Expected no previous value but got %v, %t", prev, hadPrev)
+	}
+	if prev, hadPrev := cache.GetAndSet("key", "bar", time.Now().Add(100e9)); prev != "foo" || !hadPrev {
+		t.Errorf("Expected the previous value 'foo' but got %v, %t", prev, hadPrev)
+	}
+	if result, _ := cache.Get("key"); result != "bar" {
+		t.Errorf("Expected 'bar' but got %v", result)
+	}
+}
+
+func TestGetAndDelete_ShouldReturnRemovedValue(t *testing.T) {
+	cache := NewLazy()
+	cache.Set("key", "foo", time.Now().Add(100e9))
+	if prev, hadPrev := cache.GetAndDelete("key"); prev != "foo" || !hadPrev {
+		t.Errorf("Expected the removed value 'foo' but got %v, %t", prev, hadPrev)
+	}
+	if prev, hadPrev := cache.GetAndDelete("key"); prev != nil || hadPrev {
+		t.Errorf("Expected no removed value but got %v, %t", prev, hadPrev)
+	}
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected the key to be absent but got %s", status)
+	}
+}
+
+func newNotFoundGetter() func(string) (interface{}, time.Time, error) {
+	return func(key string) (interface{}, time.Time, error) {
+		switch key {
+		case "missing":
+			return nil, time.Time{}, fmt.Errorf("no %s: %w", key, ErrNotFound)
+		case "broken":
+			return nil, time.Time{}, errors.New("backend failure")
+		}
+		return "foo", time.Now().Add(100e9), nil
+	}
+}
+
+func TestGetOrDefaultOnNotFound_Hit_ShouldReturnValue(t *testing.T) {
+	cache := New(newNotFoundGetter())
+	if result, err := cache.GetOrDefaultOnNotFound("key", "default"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+}
+
+func TestGetOrDefaultOnNotFound_NotFound_ShouldReturnDefault(t *testing.T) {
+	cache := New(newNotFoundGetter())
+	cache.SetErrorBackoff(100e9)
+	for i := 0; i < 2; i++ {
+		if result, err := cache.GetOrDefaultOnNotFound("missing", "default"); result != "default" || err != nil {
+			t.Errorf("Expected 'default' but got %v, %v", result, err)
+		}
+	}
+}
+
+func TestGetOrDefaultOnNotFound_BackendError_ShouldPropagateError(t *testing.T) {
+	cache := New(newNotFoundGetter())
+	if result, err := cache.GetOrDefaultOnNotFound("broken", "default"); result != nil || err == nil || err.Error() != "backend failure" {
+		t.Errorf("Expected the backend failure but got %v, %v", result, err)
+	}
+}
+
+func TestDeleteAndCancel_DuringFetch_ShouldCancelFetchAndLeaveItemAbsent(t *testing.T) {
+	started := make(chan bool)
+	getter := func(ctx context.Context, key string) (interface{}, time.Time, error) {
+		close(started)
+		<-ctx.Done()
+		return "late", time.Now().Add(100e9), nil
+	}
+	cache := NewWithContext(getter)
+
+	results := make(chan interface{})
+	go func() {
+		result, _ := cache.Get("key")
+		results <- result
+	}()
+	<-started
+	cache.DeleteAndCancel("key")
+	if result := <-results; result != "late" {
+		t.Errorf("Expected the canceled fetch's value but got %v", result)
+	}
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected the item to stay absent but got %v", status)
+	}
+}
+
+func TestDeleteAndCancel_NoFetch_ShouldDeleteItem(t *testing.T) {
+	getter := func(ctx context.Context, key string) (interface{}, time.Time, error) {
+		return "foo", time.Now().Add(100e9), ctx.Err()
+	}
+	cache := NewWithContext(getter)
+	if result, err := cache.Get("key"); result != "foo" || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %v", result, err)
+	}
+	cache.DeleteAndCancel("key")
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected the item to be deleted but got %v", status)
+	}
+}
+
+func TestDelete_WithDependencyChain_ShouldCascade(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.AddDependency("b", "a")
+	cache.AddDependency("c", "b")
+	cache.AddDependency("unrelated", "z")
+	for _, key := range []string{"a", "b", "c", "unrelated", "z"} {
+		cache.Get(key)
+	}
+	deleted := make(map[string]bool)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		deleted[key] = true
+	})
+	cache.Delete("a")
+
+	if !deleted["a"] || !deleted["b"] || !deleted["c"] {
+		t.Errorf("Expected a, b and c to be deleted but got %v", deleted)
+	}
+	if len(deleted) != 3 {
+		t.Errorf("Expected only 3 deletions but got %v", deleted)
+	}
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("Expected 2 entries to remain but got %d", stats.Entries)
+	}
+}
+
+func TestAddDependency_WithPurgeAndDelete_ShouldBoundDependencies(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(20)
+	cache.SetPurgeTo(10)
+	for i := 0; i < 1000; i++ {
+		parent, child := fmt.Sprintf("parent%d", i), fmt.Sprintf("child%d", i)
+		cache.Get(parent)
+		cache.Get(child)
+		cache.AddDependency(child, parent)
+	}
+	cache.Delete("parent999")
+
+	c := cache.(*readcache)
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	if len(c.Dependents) > len(c.Cache) || len(c.Dependencies) > len(c.Cache) {
+		t.Errorf("Expected at most %d keys with dependencies but got %d and %d", len(c.Cache), len(c.Dependents), len(c.Dependencies))
+	}
+	if _, ok := c.Dependents["parent999"]; ok {
+		t.Error("Expected the dependencies of the deleted key to be forgotten")
+	}
+}
+
+func TestDelete_WithDependencyCycle_ShouldTerminate(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.AddDependency("b", "a")
+	cache.AddDependency("c", "b")
+	cache.AddDependency("a", "c")
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Get(key)
+	}
+	done := make(chan bool)
+	go func() {
+		cache.Delete("b")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Delete did not return on a dependency cycle")
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected every entry in the cycle to be deleted but got %d", stats.Entries)
+	}
+}
+
+func TestDrainExpired_WithExpiredAndFreshItems_ShouldRemoveOnlyExpired(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	expiredAt := time.Now().Add(-time.Second)
+	cache.Set("expired1", "a", expiredAt)
+	cache.Set("expired2", "b", expiredAt)
+	cache.Get("fresh")
+
+	evicted := make(map[string]EvictionReason)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		evicted[key] = reason
+	})
+	drained := cache.DrainExpired()
+
+	if len(drained) != 2 {
+		t.Fatalf("Expected 2 drained entries but got %d", len(drained))
+	}
+	values := map[string]interface{}{"expired1": "a", "expired2": "b"}
+	for _, entry := range drained {
+		if values[entry.Key] != entry.Value {
+			t.Errorf("Unexpected drained entry %+v", entry)
+		}
+		if !entry.ExpiresAt.Equal(expiredAt) || entry.Superseded {
+			t.Errorf("Expected expiry %v but got %+v", expiredAt, entry)
+		}
+		if evicted[entry.Key] != EvictionExpired {
+			t.Errorf("Expected an expiry eviction for %s", entry.Key)
+		}
+	}
+	if _, ok := evicted["fresh"]; ok {
+		t.Error("The fresh item should not have been evicted")
+	}
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Expired != 0 {
+		t.Errorf("Expected only the fresh entry to remain but got %+v", stats)
+	}
+}
+
+func TestDrainExpired_AfterBumpGeneration_ShouldReportOwnExpiry(t *testing.T) {
+	cache := NewLazy()
+	expiresAt := time.Now().Add(time.Hour)
+	cache.Set("old", "a", expiresAt)
+	cache.BumpGeneration()
+	cache.Set("new", "b", expiresAt)
+
+	drained := cache.DrainExpired()
+	if len(drained) != 1 {
+		t.Fatalf("Expected 1 drained entry but got %+v", drained)
+	}
+	if entry := drained[0]; entry.Key != "old" || !entry.ExpiresAt.Equal(expiresAt) || !entry.Superseded {
+		t.Errorf("Expected old, superseded, expiring at %v, but got %+v", expiresAt, entry)
+	}
+}
+
+func TestGet_AfterBumpGeneration_ShouldFetchAgain(t *testing.T) {
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount[key]++
+		return fetchCount[key], time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Get("a")
+	cache.Get("b")
+
+	cache.BumpGeneration()
+	for _, key := range []string{"a", "b"} {
+		if status := cache.Status(key); status != StatusStale {
+			t.Errorf("Expected %s to be stale but got %s", key, status)
+		}
+		if result, _ := cache.Get(key); result != 2 {
+			t.Errorf("Expected %s to be fetched again but got %v", key, result)
+		}
+		if result, _ := cache.Get(key); result != 2 {
+			t.Errorf("Expected %s to be cached under the new generation but got %v", key, result)
+		}
+	}
+	cache.Get("c")
+	cache.Get("c")
+	if fetchCount["c"] != 1 {
+		t.Errorf("Expected a new key to be fetched once, but got %d", fetchCount["c"])
+	}
+}
+
+func TestHistory_WithHistoryDepth_ShouldKeepLastValuesInOrder(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fetchCount, clock.Now().Add(time.Minute), nil
+	}
+	refreshed := make(chan bool)
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetHistoryDepth(3)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshed <- true
+	})
+	start := clock.Now()
+	cache.Get("key")
+	for i := 0; i < 4; i++ {
+		clock.Advance(2 * time.Minute)
+		cache.RefreshExpiring(0, 1)
+		<-refreshed
+	}
+
+	history := cache.History("key")
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 historical values but got %v", history)
+	}
+	for i, entry := range history {
+		if entry.Value != i+3 || !entry.StoredAt.Equal(start.Add(time.Duration(i+2)*2*time.Minute)) {
+			t.Errorf("Expected value %d at position %d but got %v", i+3, i, entry)
+		}
+	}
+	if history := cache.History("absent"); history != nil {
+		t.Errorf("Expected no history for an absent key but got %v", history)
+	}
+}
+
+func TestKeysMatching_ShouldListUnexpiredMatchingKeys(t *testing.T) {
+	cache := NewLazy()
+	expiresAt := time.Now().Add(100e9)
+	for _, key := range []string{"user:1", "user:22", "user:x", "order:1", "user:"} {
+		cache.Set(key, key, expiresAt)
+	}
+	cache.Set("user:3", "expired", time.Now().Add(-time.Second))
+
+	keys, err := cache.KeysMatching(`^user:\d+$`)
+	if err != nil || !slices.Equal(keys, []string{"user:1", "user:22"}) {
+		t.Errorf("Expected [user:1 user:22] but got %v, %v", keys, err)
+	}
+	if keys, err := cache.KeysMatching("(unclosed"); err == nil || keys != nil {
+		t.Errorf("Expected a compile error but got %v, %v", keys, err)
+	}
+}
+
+func TestSnapshot_ShouldCopyUnexpiredItems(t *testing.T) {
+	cache := NewLazy()
+	expiresAt := time.Now().Add(100e9)
+	cache.Set("a", 1, expiresAt)
+	cache.Set("b", 2, expiresAt.Add(time.Second))
+	cache.Set("expired", 3, time.Now().Add(-time.Second))
+
+	snapshot := cache.Snapshot()
+	expected := map[string]SnapshotEntry{
+		"a": {1, expiresAt},
+		"b": {2, expiresAt.Add(time.Second)},
+	}
+	if len(snapshot) != len(expected) {
+		t.Errorf("Expected %d entries but got %d", len(expected), len(snapshot))
+	}
+	for key, entry := range expected {
+		if got, ok := snapshot[key]; !ok || got.Value != entry.Value || !got.ExpiresAt.Equal(entry.ExpiresAt) {
+			t.Errorf("Expected %+v for %s but got %+v", entry, key, got)
+		}
+	}
+
+	cache.Delete("a")
+	if _, ok := snapshot["a"]; !ok {
+		t.Error("The snapshot should not change with the cache")
+	}
+}
+
+func TestTopKeys_WithUnevenAccess_ShouldOrderByCount(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetTrackKeyAccess(true)
+	accesses := map[string]int{"cold": 1, "warm": 3, "hot": 6, "hottest": 10}
+	for key, count := range accesses {
+		for i := 0; i < count; i++ {
+			cache.Get(key)
+		}
+	}
+
+	top := cache.TopKeys(3)
+	expected := []KeyCount{{"hottest", 9}, {"hot", 5}, {"warm", 2}}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d keys but got %v", len(expected), top)
+	}
+	for i := range expected {
+		if top[i] != expected[i] {
+			t.Errorf("Expected %+v at %d but got %+v", expected[i], i, top[i])
+		}
+	}
+}
+
+func TestTopKeys_WithoutTracking_ShouldReportNothing(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	cache.Get("key")
+	if top := cache.TopKeys(10); len(top) != 0 {
+		t.Errorf("Expected no keys but got %v", top)
+	}
+}
+
+func TestGet_WithOnEvict_WithPurgeRules_ShouldReportCapacityEviction(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	var evictedKeys []string
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		if reason != EvictionCapacity {
+			t.Errorf("Expected a capacity eviction but got %s", reason)
+		}
+		evictedKeys = append(evictedKeys, key)
+	})
+	cache.Get("1")
+	cache.Get("2")
+	if len(evictedKeys) != 1 || evictedKeys[0] != "1" {
+		t.Errorf("Expected key '1' to be evicted but got %v", evictedKeys)
+	}
+}
+
+func TestGet_WithTwoObservers_ShouldNotifyBoth(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	first := &recordingObserver{}
+	second := &recordingObserver{}
+	cache.AddObserver(first)
+	cache.AddObserver(second)
+	cache.Get("1")
+	cache.Get("1")
+	cache.Get("2")
+
+	expected := []string{"miss 1", "fetch 1", "hit 1", "miss 2", "fetch 2", "evict 1 capacity"}
+	for _, observer := range []*recordingObserver{first, second} {
+		events := observer.Events()
+		if fmt.Sprint(events) != fmt.Sprint(expected) {
+			t.Errorf("Expected %v but got %v", expected, events)
+		}
+	}
+}
+
+func TestGet_WithObserverCallingBackIntoCache_ShouldNotDeadlock(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.AddObserver(&reentrantObserver{cache})
+	done := make(chan bool)
+	go func() {
+		cache.Get("key")
+		cache.Get("key")
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get did not return; an observer callback deadlocked the cache")
+	}
+}
+
+func TestGet_WithTTLOverride_ShouldShortenMatchingKeys(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetTTLOverride(func(key string, value interface{}, getterExpiry time.Time) time.Time {
+		if strings.HasPrefix(key, "volatile:") {
+			return time.Now().Add(-1)
+		}
+		return getterExpiry
+	})
+
+	cache.Get("volatile:1")
+	cache.Get("volatile:1")
+	if fetchCount != 2 {
+		t.Errorf("Expected the overridden key to expire and be fetched twice, but got %d", fetchCount)
+	}
+	fetchCount = 0
+	cache.Get("stable:1")
+	cache.Get("stable:1")
+	if fetchCount != 1 {
+		t.Errorf("Expected the other key to keep its expiry and be fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithMinResultReuse_BurstOfCalls_ShouldFetchOnce(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now(), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetMinResultReuse(50 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		cache.Get("key")
+		clock.Advance(time.Millisecond)
+	}
+	if fetchCount != 1 {
+		t.Errorf("Expected a single fetch within the reuse window, but got %d", fetchCount)
+	}
+	clock.Advance(50 * time.Millisecond)
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Expected a fetch after the reuse window, but got %d", fetchCount)
+	}
+}
+
+func TestCompute_ConcurrentCalls_ShouldComputeOnce(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	fetchCount := 0
+	fn := func() (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount++
+		fetchLock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := NewLazy()
+	quit := make(chan bool)
+	for r := 0; r < 32; r++ {
+		go func() {
+			if result, err := cache.Compute("key", fn); result != "foo" || err != nil {
+				t.Errorf("Expected 'foo' but got %v, %v", result, err)
+			}
+			quit <- true
+		}()
+	}
+	for r := 0; r < 32; r++ {
+		<-quit
+	}
+	if fetchCount != 1 {
+		t.Errorf("Should have only computed once, but got %d", fetchCount)
+	}
+	if result, err := cache.Get("key"); result != "foo" || err != nil {
+		t.Errorf("Expected the computed value to be cached, but got %v, %v", result, err)
+	}
+}
+
+func TestGet_WithSlidingExpiration_ShouldKeepAccessedKeyAndExpireIdleKey(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount[key]++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetSlidingExpiration(time.Minute)
+	cache.Get("active")
+	cache.Get("idle")
+
+	for i := 0; i < 10; i++ {
+		clock.Advance(30 * time.Second)
+		cache.Get("active")
+	}
+	cache.Get("idle")
+	if fetchCount["active"] != 1 {
+		t.Errorf("Expected the active key to be fetched once, but got %d", fetchCount["active"])
+	}
+	if fetchCount["idle"] != 2 {
+		t.Errorf("Expected the idle key to expire and be fetched twice, but got %d", fetchCount["idle"])
+	}
+}
+
+func TestGet_WithoutSlidingExpiration_ShouldExpireAccessedKey(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	for i := 0; i < 3; i++ {
+		cache.Get("key")
+		clock.Advance(30 * time.Second)
+	}
+	if fetchCount != 2 {
+		t.Errorf("Expected the key to expire and be fetched twice, but got %d", fetchCount)
+	}
+}
+
+func TestGet_WithOnHitExpiry_ExtendingExpiry_ShouldKeepKeyAlive(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetOnHitExpiry(func(key string, value interface{}, currentExpiry time.Time) time.Time {
+		if key == "extended" {
+			return currentExpiry.Add(30 * time.Second)
+		}
+		return currentExpiry
+	})
+	for i := 0; i < 5; i++ {
+		cache.Get("extended")
+		cache.Get("unchanged")
+		clock.Advance(30 * time.Second)
+	}
+	if fetchCount != 4 {
+		t.Errorf("Expected only the unchanged key to be fetched again, but got %d fetches", fetchCount)
+	}
+	if expiry := expiryOf(cache, "extended"); !expiry.After(clock.Now()) {
+		t.Errorf("Expected the extended key to be kept alive, but it expires at %v", expiry)
+	}
+}
+
+func TestGet_WithStaleWhileRevalidate_ShouldServeStaleAndRefreshInBackground(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchLock := new(sync.Mutex)
+	fetchCount := 0
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount++
+		count := fetchCount
+		fetchLock.Unlock()
+		if count > 1 {
+			<-unblock
+		}
+		return count, clock.Now().Add(time.Minute), nil
+	}
+	type refreshed struct {
+		key   string
+		value interface{}
+		err   error
+	}
+	refreshes := make(chan refreshed, 10)
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetStaleWhileRevalidate(time.Minute)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshes <- refreshed{key, newValue, err}
+	})
+	cache.Get("key")
+
+	clock.Advance(90 * time.Second)
+	for i := 0; i < 3; i++ {
+		if result, err := cache.Get("key"); result != 1 || err != nil {
+			t.Errorf("Expected the stale value 1 but got %v, %v", result, err)
+		}
+	}
+	close(unblock)
+	got := <-refreshes
+	if got.key != "key" || got.value != 2 || got.err != nil {
+		t.Errorf("Expected a refresh of key to 2 but got %+v", got)
+	}
+	if result, _ := cache.Get("key"); result != 2 {
+		t.Errorf("Expected the refreshed value 2 but got %v", result)
+	}
+	if fetchCount != 2 {
+		t.Errorf("Expected a single refresh, but got %d fetches", fetchCount)
+	}
+	select {
+	case got := <-refreshes:
+		t.Errorf("Unexpected refresh %+v", got)
+	default:
+	}
+}
+
+func TestStats_WithStaleWhileRevalidate_ShouldCountFreshAndStaleHits(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	refreshed := make(chan struct{}, 10)
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetStaleWhileRevalidate(time.Hour)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshed <- struct{}{}
+	})
+	cache.Get("key")
+	cache.Get("key")
+	cache.Get("key")
+
+	clock.Advance(2 * time.Minute)
+	cache.Get("key")
+	<-refreshed
+	cache.Get("key")
+
+	stats := cache.Stats()
+	if stats.Hits != 4 || stats.FreshHits != 3 || stats.StaleHits != 1 || stats.BackgroundRefreshes != 1 {
+		t.Errorf("Expected 4 hits, 3 fresh and 1 stale, and 1 refresh, but got %+v", stats)
+	}
+}
+
+func TestGet_WithStaleWhileRevalidate_PastWindow_ShouldFetchInForeground(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fetchCount, clock.Now().Add(time.Minute), nil
+	}
+	refreshCount := 0
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetStaleWhileRevalidate(time.Minute)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshCount++
+	})
+	cache.Get("key")
+
+	clock.Advance(3 * time.Minute)
+	if result, err := cache.Get("key"); result != 2 || err != nil {
+		t.Errorf("Expected the fetched value 2 but got %v, %v", result, err)
+	}
+	if refreshCount != 0 {
+		t.Errorf("Expected no background refresh, but got %d", refreshCount)
+	}
+}
+
+func TestGet_WithRefetchSampling_ItemExpired_ShouldRefreshOnEveryNthHit(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fetchCount, clock.Now().Add(time.Minute), nil
+	}
+	refreshed := make(chan struct{}, 1)
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetRefetchSampling(10)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshed <- struct{}{}
+	})
+	cache.Get("key")
+
+	clock.Advance(2 * time.Minute)
+	for i := 1; i <= 100; i++ {
+		if result, err := cache.Get("key"); result != 1+(i-1)/10 || err != nil {
+			t.Fatalf("Expected the stale value %d on hit %d but got %v, %v", 1+(i-1)/10, i, result, err)
+		}
+		if i%10 == 0 {
+			<-refreshed
+			clock.Advance(2 * time.Minute)
+		}
+	}
+	if fetchCount != 11 {
+		t.Errorf("Expected one refresh per ten hits, but got %d fetches", fetchCount)
+	}
+}
+
+func TestGet_DuringBackgroundRefresh_ItemExpired_ShouldJoinRefresh(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetching := make(chan bool, 2)
+	unblock := make(chan bool)
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetching <- true
+		<-unblock
+		return fetchCount.Add(1), clock.Now().Add(time.Hour), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.Set("key", int32(0), clock.Now().Add(time.Minute))
+	joined := make(chan bool)
+	cache.(*readcache).Hook = func(point hookPoint, key string) {
+		if point == hookJoin {
+			close(joined)
+		}
+	}
+
+	cache.RefreshExpiring(time.Hour, 1)
+	<-fetching
+	clock.Advance(2 * time.Minute)
+	results := make(chan interface{})
+	go func() {
+		result, _ := cache.Get("key")
+		results <- result
+	}()
+	<-joined
+	close(unblock)
+	if result := <-results; result != int32(1) {
+		t.Errorf("Expected the refreshed value 1 but got %v", result)
+	}
+	if fetchCount.Load() != 1 {
+		t.Errorf("Expected the Get to share the refresh, but got %d fetches", fetchCount.Load())
+	}
+}
+
+func TestGet_WithValidator_ShouldRefetchOnlyRejectedItems(t *testing.T) {
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount[key]++
+		return fetchCount[key], time.Now().Add(100e9), nil
+	}
+	revoked := make(map[string]bool)
+	var reasons []EvictionReason
+	cache := New(getter)
+	cache.SetValidator(func(key string, value interface{}) bool {
+		return !revoked[key]
+	})
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		reasons = append(reasons, reason)
+	})
+	cache.Get("kept")
+	cache.Get("revoked")
+
+	revoked["revoked"] = true
+	if result, _ := cache.Get("kept"); result != 1 {
+		t.Errorf("Expected the cached value 1 but got %v", result)
+	}
+	if result, _ := cache.Get("revoked"); result != 2 {
+		t.Errorf("Expected the refetched value 2 but got %v", result)
+	}
+	if len(reasons) != 1 || reasons[0] != EvictionInvalid {
+		t.Errorf("Expected a single invalid eviction but got %v", reasons)
+	}
+}
+
+func TestGet_WithPastExpiryPolicy_ShouldPreventRefetchLoop(t *testing.T) {
+	for _, test := range []struct {
+		policy      PastExpiryPolicy
+		fetchCount  int
+		expectedErr error
+	}{
+		{PastExpiryAllow, 3, nil},
+		{PastExpiryError, 1, ErrPastExpiry},
+		{PastExpiryMinimumTTL, 1, nil},
+		{PastExpiryDontCache, 3, nil},
+	} {
+		fetchCount := 0
+		getter := func(key string) (interface{}, time.Time, error) {
+			fetchCount++
+			return "foo", time.Now().Add(-time.Second), nil
+		}
+		cache := New(getter)
+		cache.SetErrorBackoff(100e9)
+		cache.SetPastExpiryPolicy(test.policy, time.Minute)
+		for i := 0; i < 3; i++ {
+			if _, err := cache.Get("key"); err != test.expectedErr {
+				t.Errorf("%s: expected %v but got %v", test.policy, test.expectedErr, err)
+			}
+		}
+		if fetchCount != test.fetchCount {
+			t.Errorf("%s: expected %d fetches but got %d", test.policy, test.fetchCount, fetchCount)
+		}
+		if test.policy == PastExpiryDontCache && cache.Status("key") != StatusAbsent {
+			t.Errorf("%s: expected nothing to be cached", test.policy)
+		}
+	}
+}
+
+func TestGet_WithMonotonicExpiry_WallClockJump_ShouldNotExpire(t *testing.T) {
+	clock := &jumpingClock{TestClock: TestClock{now: time.Now()}}
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetMonotonicExpiry(true)
+	cache.Get("key")
+
+	clock.Jump(time.Hour)
+	cache.Get("key")
+	if fetchCount != 1 {
+		t.Errorf("Expected the item to survive the jump, but got %d fetches", fetchCount)
+	}
+	clock.Advance(2 * time.Minute)
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Expected the item to expire once its TTL elapsed, but got %d fetches", fetchCount)
+	}
+}
+
+func TestGet_WithoutMonotonicExpiry_WallClockJump_ShouldExpire(t *testing.T) {
+	clock := &jumpingClock{TestClock: TestClock{now: time.Now()}}
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.Get("key")
+
+	clock.Jump(time.Hour)
+	cache.Get("key")
+	if fetchCount != 2 {
+		t.Errorf("Expected the item to expire on the jump, but got %d fetches", fetchCount)
+	}
+}
+
+func TestGet_WithMaxInFlightFetches_Rejecting_ShouldCapReadControls(t *testing.T) {
+	started := make(chan struct{}, 100)
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		started <- struct{}{}
+		<-unblock
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxInFlightFetches(4, false)
+
+	var wait sync.WaitGroup
+	errs := make(chan error, 100)
+	get := func(key string) {
+		defer wait.Done()
+		if _, err := cache.Get(key); err != nil {
+			errs <- err
+		}
+	}
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go get(fmt.Sprintf("held%d", i))
+		<-started
+	}
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+		go get(fmt.Sprintf("excess%d", i))
+	}
+	for len(errs) < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	close(unblock)
+	wait.Wait()
+	close(errs)
+
+	rejected := 0
+	for err := range errs {
+		if err != ErrTooManyInFlight {
+			t.Errorf("Expected ErrTooManyInFlight but got %v", err)
+		}
+		rejected++
+	}
+	if rejected != 50 {
+		t.Errorf("Expected the 50 excess gets to be rejected, but got %d", rejected)
+	}
+	if stats := cache.Stats(); stats.Entries != 4 {
+		t.Errorf("Expected the 4 held keys to be cached but got %d entries", stats.Entries)
+	}
+}
+
+func TestGet_WithMaxInFlightFetches_Blocking_ShouldCapConcurrentFetches(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	inFlight, maxInFlight := 0, 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		fetchLock.Unlock()
+		time.Sleep(time.Millisecond)
+		fetchLock.Lock()
+		inFlight--
+		fetchLock.Unlock()
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxInFlightFetches(4, true)
+
+	var wait sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wait.Add(1)
+		go func(key string) {
+			defer wait.Done()
+			if _, err := cache.Get(key); err != nil {
+				t.Errorf("Unexpected error: %s", err.Error())
+			}
+		}(fmt.Sprintf("%d", i))
+	}
+	wait.Wait()
+
+	if maxInFlight > 4 {
+		t.Errorf("Expected at most 4 concurrent fetches but got %d", maxInFlight)
+	}
+	if stats := cache.Stats(); stats.Entries != 100 {
+		t.Errorf("Expected 100 entries but got %d", stats.Entries)
+	}
+}
+
+func TestGet_WithConflictResolver_SplitFetches_ShouldStoreResolversChoice(t *testing.T) {
+	stuck := make(chan bool)
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		if fetchCount.Add(1) == 1 {
+			<-stuck
+			return "stuck", time.Now().Add(100e9), nil
+		}
+		return "overflow", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxCoalesceBeforeSplit(1)
+	cache.SetConflictResolver(FirstWriteWins)
+	c := cache.(*readcache)
+	waiters := func() int64 {
+		c.ReadControlsLock.RLock()
+		defer c.ReadControlsLock.RUnlock()
+		if control, ok := c.ReadControls["key"]; ok {
+			return control.Waiters.Load()
+		}
+		return -1
+	}
+
+	results := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			result, _ := cache.Get("key")
+			results <- result
+		}()
+		for waiters() != int64(i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if result, _ := cache.Get("key"); result != "overflow" {
+		t.Fatalf("Expected the overflow fetch to be stored first, but got %v", result)
+	}
+	close(stuck)
+
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "overflow" {
+			t.Errorf("Expected the stuck fetch to yield the first write, but got %v", result)
+		}
+	}
+	if result, _ := cache.Get("key"); result != "overflow" {
+		t.Errorf("Expected the first write to be kept, but got %v", result)
+	}
+}
+
+func TestGet_WithMaxCoalesceBeforeSplit_StuckFetch_ShouldStartSecondFetch(t *testing.T) {
+	stuck := make(chan bool)
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		if fetchCount.Add(1) == 1 {
+			<-stuck
+			return "stuck", time.Now().Add(100e9), nil
+		}
+		return "overflow", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxCoalesceBeforeSplit(3)
+	c := cache.(*readcache)
+	waiters := func() int64 {
+		c.ReadControlsLock.RLock()
+		defer c.ReadControlsLock.RUnlock()
+		if control, ok := c.ReadControls["key"]; ok {
+			return control.Waiters.Load()
+		}
+		return -1
+	}
+
+	results := make(chan interface{}, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			result, _ := cache.Get("key")
+			results <- result
+		}()
+		for waiters() != int64(i) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if fetchCount.Load() != 1 {
+		t.Errorf("Expected the waiters to share the stuck fetch, but got %d fetches", fetchCount.Load())
+	}
+
+	if result, _ := cache.Get("key"); result != "overflow" {
+		t.Errorf("Expected a second fetch past the threshold, but got %v", result)
+	}
+	if fetchCount.Load() != 2 {
+		t.Errorf("Expected 2 fetches but got %d", fetchCount.Load())
+	}
+	close(stuck)
+	for i := 0; i < 4; i++ {
+		if result := <-results; result != "stuck" {
+			t.Errorf("Expected the waiters to get the stuck fetch's result, but got %v", result)
+		}
+	}
+}
+
+func TestGet_WithHook_SecondCallerDuringFetch_ShouldWaitRatherThanFetch(t *testing.T) {
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount.Add(1)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	arrived := make(chan bool)
+	release := make(chan bool)
+	joined := make(chan bool)
+	var fetches atomic.Int32
+	cache.(*readcache).Hook = func(point hookPoint, key string) {
+		switch point {
+		case hookFetch:
+			if fetches.Add(1) == 1 {
+				close(arrived)
+				<-release
+			}
+		case hookJoin:
+			close(joined)
+		}
+	}
+
+	results := make(chan interface{}, 2)
+	get := func() {
+		result, _ := cache.Get("key")
+		results <- result
+	}
+	go get()
+	<-arrived
+	go get()
+	<-joined
+	close(release)
+	for i := 0; i < 2; i++ {
+		if result := <-results; result != "foo" {
+			t.Errorf("Expected 'foo' but got %v", result)
+		}
+	}
+	if fetches.Load() != 1 || fetchCount.Load() != 1 {
+		t.Errorf("Expected the second caller to share the first fetch, but got %d fetches", fetchCount.Load())
+	}
+}
+
+func TestGetForceRefresh_WithCachedItem_ShouldFetchAndUpdateItem(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fetchCount, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Get("key")
+
+	if result, err := cache.GetForceRefresh("key"); result != 2 || err != nil {
+		t.Errorf("Expected the fresh value 2 but got %v, %v", result, err)
+	}
+	if result, _ := cache.Get("key"); result != 2 || fetchCount != 2 {
+		t.Errorf("Expected the refreshed item to be cached, but got %v after %d fetches", result, fetchCount)
+	}
+}
+
+func TestGetForceRefresh_DuringFetch_ShouldShareFetch(t *testing.T) {
+	release := make(chan bool)
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount.Add(1)
+		<-release
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	go cache.Get("key")
+	for len(cache.InFlight()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	if result, err := cache.GetForceRefresh("key"); result != "foo" || err != nil {
+		t.Errorf("Expected foo but got %v, %v", result, err)
+	}
+	if n := fetchCount.Load(); n != 1 {
+		t.Errorf("Expected a single shared fetch but got %d", n)
+	}
+}
+
+func TestGetWithTTL_ShouldOverrideGetterExpiryOnMiss(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", clock.Now().Add(time.Hour), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+
+	if result, err := cache.GetWithTTL("key", time.Second); result != "foo" || err != nil {
+		t.Errorf("Expected foo but got %v, %v", result, err)
+	}
+	if expiry := expiryOf(cache, "key"); !expiry.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("Expected the item to expire in a second but it expires at %v", expiry)
+	}
+	cache.GetWithTTL("key", time.Minute)
+	if expiry := expiryOf(cache, "key"); !expiry.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("Expected a hit to keep the expiry but it expires at %v", expiry)
+	}
+}
+
+func TestGetWithETag_ShouldBeStableUntilValueChanges(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return fmt.Sprintf("value %d", fetchCount), clock.Now().Add(time.Minute), nil
+	}
+	hashCount := 0
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetETagFunc(func(value interface{}) string {
+		hashCount++
+		return fmt.Sprintf("%q", value)
+	})
+
+	_, first, _ := cache.GetWithETag("key")
+	_, again, _ := cache.GetWithETag("key")
+	if first != `"value 1"` || again != first {
+		t.Errorf("Expected a stable ETag but got %s then %s", first, again)
+	}
+	if hashCount != 1 {
+		t.Errorf("Expected the ETag to be computed once, but got %d", hashCount)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if value, refreshed, _ := cache.GetWithETag("key"); value != "value 2" || refreshed == first {
+		t.Errorf("Expected a new ETag for the refreshed value, but got %s for %v", refreshed, value)
+	}
+}
+
+func TestGetNoFetch_NoFetchUnderway_ShouldReturnNotFound(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.Set("cached", "bar", time.Now().Add(100e9))
+
+	if value, found, err := cache.GetNoFetch("key"); value != nil || found || err != nil {
+		t.Errorf("Expected not found but got %v, %t, %v", value, found, err)
+	}
+	if value, found, err := cache.GetNoFetch("cached"); value != "bar" || !found || err != nil {
+		t.Errorf("Expected 'bar' but got %v, %t, %v", value, found, err)
+	}
+	if fetchCount != 0 {
+		t.Errorf("Expected the getter not to be called, but got %d", fetchCount)
+	}
+}
+
+func TestGetNoFetch_FetchUnderway_ShouldWaitForFetch(t *testing.T) {
+	unblock := make(chan struct{})
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-unblock
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	go cache.Get("key")
+	waitForReadControl(t, cache, "key")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(unblock)
+	}()
+	if value, found, err := cache.GetNoFetch("key"); value != "foo" || !found || err != nil {
+		t.Errorf("Expected 'foo' but got %v, %t, %v", value, found, err)
+	}
+}
+
+func TestStatus_ShouldDistinguishAbsentFreshAndStale(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected absent but got %s", status)
+	}
+	cache.Get("key")
+	if status := cache.Status("key"); status != StatusFresh {
+		t.Errorf("Expected fresh but got %s", status)
+	}
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if status := cache.Status("key"); status != StatusStale {
+			t.Errorf("Expected stale but got %s", status)
+		}
+	}
+	if fetchCount != 1 {
+		t.Errorf("Status should not fetch, but fetchCount was %d", fetchCount)
+	}
+}
+
+func TestRemaining_ClockAdvances_ShouldCountDownToExpiry(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	getter := func(key string) (interface{}, time.Time, error) {
+		return "foo", clock.Now().Add(time.Minute), nil
+	}
+	cache := New(getter)
+	cache.SetClock(clock)
+
+	if remaining, ok := cache.Remaining("key"); remaining != 0 || ok {
+		t.Errorf("Expected nothing remaining for an absent key but got %v, %v", remaining, ok)
+	}
+	cache.Get("key")
+	if remaining, ok := cache.Remaining("key"); remaining != time.Minute || !ok {
+		t.Errorf("Expected a minute remaining but got %v, %v", remaining, ok)
+	}
+	clock.Advance(20 * time.Second)
+	if remaining, ok := cache.Remaining("key"); remaining != 40*time.Second || !ok {
+		t.Errorf("Expected 40s remaining but got %v, %v", remaining, ok)
+	}
+	clock.Advance(time.Minute)
+	if remaining, ok := cache.Remaining("key"); remaining != -20*time.Second || ok {
+		t.Errorf("Expected expiry 20s ago but got %v, %v", remaining, ok)
+	}
+}
+
+func TestInFlight_SlowFetch_ShouldListKeyUntilComplete(t *testing.T) {
+	release := make(chan bool)
+	getter := func(key string) (interface{}, time.Time, error) {
+		<-release
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	before := time.Now()
+	done := make(chan bool)
+	go func() {
+		cache.Get("slow")
+		done <- true
+	}()
+
+	var fetches []InFlightFetch
+	for len(fetches) == 0 {
+		fetches = cache.InFlight()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(fetches) != 1 || fetches[0].Key != "slow" {
+		t.Fatalf("Expected the slow fetch to be in flight but got %v", fetches)
+	}
+	if elapsed := time.Since(fetches[0].Started); fetches[0].Started.Before(before) || elapsed < 10*time.Millisecond {
+		t.Errorf("Expected a plausible start time but got %v, %v in flight", fetches[0].Started, elapsed)
+	}
+
+	close(release)
+	<-done
+	if fetches := cache.InFlight(); len(fetches) != 0 {
+		t.Errorf("Expected no fetches in flight but got %v", fetches)
+	}
+}
+
+func TestGet_WithMaxKeyLength_LongKey_ShouldReturnErrKeyTooLong(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetMaxKeyLength(8)
+	longKey := strings.Repeat("k", 9)
+
+	if _, err := cache.Get(longKey); err != ErrKeyTooLong {
+		t.Errorf("Expected ErrKeyTooLong from Get but got %v", err)
+	}
+	if err := cache.Set(longKey, "foo", time.Now().Add(100e9)); err != ErrKeyTooLong {
+		t.Errorf("Expected ErrKeyTooLong from Set but got %v", err)
+	}
+	if cache.SetIfVersion(longKey, "foo", time.Now().Add(100e9), 0) {
+		t.Error("Expected SetIfVersion to refuse the long key")
+	}
+	if fetchCount != 0 || cache.Status(longKey) != StatusAbsent {
+		t.Errorf("Expected nothing to be fetched or cached, but fetchCount was %d", fetchCount)
+	}
+	if _, err := cache.Get(strings.Repeat("k", 8)); err != nil {
+		t.Errorf("Expected a key at the limit to be accepted, but got %v", err)
+	}
+}
+
+func TestStatsDelta_ShouldReportOnlyActivitySinceLastCall(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	cache.Get("key")
+	if delta := cache.StatsDelta(); delta.Hits != 1 || delta.Entries != 1 {
+		t.Errorf("Expected 1 hit on 1 entry but got %d on %d", delta.Hits, delta.Entries)
+	}
+
+	cache.Get("key")
+	cache.Get("key")
+	cache.Get("other")
+	if delta := cache.StatsDelta(); delta.Hits != 2 || delta.FreshHits != 2 || delta.Entries != 2 {
+		t.Errorf("Expected 2 fresh hits on 2 entries but got %d (%d fresh) on %d", delta.Hits, delta.FreshHits, delta.Entries)
+	}
+	if stats := cache.Stats(); stats.Hits != 3 {
+		t.Errorf("Expected Stats to keep counting 3 hits but got %d", stats.Hits)
+	}
+}
+
+func TestStats_WithKnownExpiries_ShouldReportDistribution(t *testing.T) {
+	expiries := map[string]time.Duration{
+		"expired": -time.Second,
+		"30s":     30 * time.Second,
+		"45s":     45 * time.Second,
+		"30m":     30 * time.Minute,
+		"2h":      2 * time.Hour,
+	}
+	getter := func(key string) (interface{}, time.Time, error) {
+		return key, time.Now().Add(expiries[key]), nil
+	}
+	cache := New(getter)
+	for key := range expiries {
+		cache.Get(key)
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 5 {
+		t.Errorf("Expected 5 entries but got %d", stats.Entries)
+	}
+	if stats.Expired != 1 {
+		t.Errorf("Expected 1 expired entry but got %d", stats.Expired)
+	}
+	if stats.ExpiringWithinMinute != 2 {
+		t.Errorf("Expected 2 entries expiring within a minute but got %d", stats.ExpiringWithinMinute)
+	}
+	if stats.ExpiringWithinHour != 3 {
+		t.Errorf("Expected 3 entries expiring within an hour but got %d", stats.ExpiringWithinHour)
+	}
+	expectedTTL := (30*time.Second + 45*time.Second + 30*time.Minute + 2*time.Hour) / 4
+	if diff := expectedTTL - stats.AverageTTL; diff < 0 || diff > time.Second {
+		t.Errorf("Expected an average TTL of about %v but got %v", expectedTTL, stats.AverageTTL)
+	}
+}
+
+func TestStats_WithEmptyCache_ShouldReportNothing(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	stats := cache.Stats()
+	if stats != (CacheStats{}) {
+		t.Errorf("Expected empty stats but got %+v", stats)
+	}
+}
+
+func TestGet_WithPurgeRules_WithPinnedKey_ShouldNotPurgePinnedKey(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetPurgeAt(3)
+	cache.SetPurgeTo(1)
+	cache.Pin("pinned")
+
+	cache.Get("pinned")
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("%d", i))
+	}
+	fetchCount = 0
+	cache.Get("pinned")
+	if fetchCount != 0 {
+		t.Errorf("The pinned key should have survived purges, but was fetched %d times", fetchCount)
+	}
+}
+
+func TestSet_WithEvictionChunkSize_LargePurge_ShouldLetReadersInBetweenChunks(t *testing.T) {
+	// 999 items are purged at once: in one go, or in 100 chunks.
+	for chunkSize, pauses := range map[int]int{0: 0, 10: 99} {
+		cache := NewLazy()
+		cache.SetPurgeAt(1000)
+		cache.SetPurgeTo(1)
+		cache.SetEvictionChunkSize(chunkSize)
+		cache.Pin("reader")
+		cache.Set("reader", "foo", time.Now().Add(100e9))
+		chunks := 0
+		cache.(*readcache).Hook = func(point hookPoint, key string) {
+			if point != hookPurgeChunk {
+				return
+			}
+			chunks++
+			// The purge must not hold the lock between chunks.
+			if result, found, _ := cache.GetNoFetch("reader"); result != "foo" || !found {
+				t.Errorf("Expected 'foo' between chunks but got %v, %v", result, found)
+			}
+		}
+
+		for i := 0; i < 999; i++ {
+			cache.Set(fmt.Sprintf("%d", i), "foo", time.Now().Add(100e9))
+		}
+		if chunks != pauses {
+			t.Errorf("Expected %d pauses with chunk size %d but got %d", pauses, chunkSize, chunks)
+		}
+		if stats := cache.Stats(); stats.Entries != 1 {
+			t.Errorf("Expected only the pinned entry to remain with chunk size %d but got %d", chunkSize, stats.Entries)
+		}
+	}
+}
+
+func TestSet_WithPurgeRules_PinnedKeySetRepeatedly_ShouldBoundAdditions(t *testing.T) {
+	cache := NewLazy()
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	cache.Pin("pinned")
+	for i := 0; i < 1000; i++ {
+		cache.Set("pinned", i, time.Now().Add(100e9))
+	}
+
+	c := cache.(*readcache)
+	c.CacheLock.RLock()
+	additions, count := c.Additions.Len(), c.AdditionCount
+	c.CacheLock.RUnlock()
+	if additions > 2 || count != additions {
+		t.Errorf("Expected at most 2 additions but got %d, counted as %d", additions, count)
+	}
+	if result, found, _ := cache.GetNoFetch("pinned"); result != 999 || !found {
+		t.Errorf("Expected the pinned key's latest value 999 but got %v, %v", result, found)
+	}
+}
+
+func TestGet_WithPurgeRules_WithAllKeysPinned_ShouldStopPurging(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(0)
+	cache.Pin("1")
+	cache.Pin("2")
+	cache.Get("1")
+	cache.Get("2")
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("Expected both pinned entries to remain but got %d", stats.Entries)
 	}
-	cache.Get("3") // {1, 2, 3} -> Purge -> {3}
-	cache.Get("3")
-	if fetchCount != 3 {
-		t.Errorf("Expected fetchCount = 3 but was %d", fetchCount)
+}
+
+func TestGet_WithPurgeRules_AfterUnpin_ShouldPurgeKey(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "foo", time.Now().Add(100e9), nil
 	}
+	cache := New(getter)
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	cache.Pin("1")
 	cache.Get("1")
-	cache.Get("2") // {1, 2, 3} -> Purge -> {2}
-	if fetchCount != 5 {
-		t.Errorf("Expected fetchCount = 5 but was %d", fetchCount)
+	cache.Unpin("1")
+	cache.Get("2") // {1, 2} -> Purge -> {2}
+	fetchCount = 0
+	cache.Get("1")
+	if fetchCount != 1 {
+		t.Errorf("The unpinned key should have been purged, but fetchCount was %d", fetchCount)
 	}
-	cache.Get("3")
-	if fetchCount != 6 {
-		t.Errorf("Expected fetchCount = 6 but was %d", fetchCount)
+}
+
+func TestGet_WithPurgeRules_WithPriorityTiers_ShouldPurgeLowerTiersFirst(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(10)
+	cache.SetPurgeTo(6)
+	cache.SetPriorityTier("tmp:", -1)
+	cache.SetPriorityTier("core:", 1)
+
+	// The core keys are the oldest, so they would be purged first without tiers.
+	for i := 0; i < 3; i++ {
+		cache.Get(fmt.Sprintf("core:%d", i))
 	}
-	cache.Get("2")
-	if fetchCount != 6 {
-		t.Errorf("Expected fetchCount = 6 but was %d", fetchCount)
+	for i := 0; i < 3; i++ {
+		cache.Get(fmt.Sprintf("plain:%d", i))
+	}
+	for i := 0; i < 4; i++ {
+		cache.Get(fmt.Sprintf("tmp:%d", i))
+	}
+
+	for key, expected := range map[string]KeyStatus{
+		"core:0": StatusFresh, "core:1": StatusFresh, "core:2": StatusFresh,
+		"plain:0": StatusFresh, "plain:1": StatusFresh, "plain:2": StatusFresh,
+		"tmp:0": StatusAbsent, "tmp:1": StatusAbsent, "tmp:2": StatusAbsent,
+		"tmp:3": StatusAbsent,
+	} {
+		if status := cache.Status(key); status != expected {
+			t.Errorf("Expected %s to be %s but got %s", key, expected, status)
+		}
+	}
+}
+
+func TestGet_WithPurgeRules_WithPriorityTiers_ShouldFallBackToHigherTiers(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(4)
+	cache.SetPurgeTo(1)
+	cache.SetPriorityTier("tmp:", -1)
+
+	cache.Get("core:0")
+	cache.Get("core:1")
+	cache.Get("tmp:0")
+	cache.Get("core:2") // {core:0, core:1, tmp:0, core:2} -> Purge -> {core:2}
+
+	if stats := cache.Stats(); stats.Entries != 1 || cache.Status("core:2") != StatusFresh {
+		t.Errorf("Expected only the newest key to remain but got %d entries", stats.Entries)
 	}
 }
 
@@ -233,6 +2436,138 @@ func runConcurrencyTest(cache Cache, numGoroutines int, numFetches int) {
 	}
 }
 
+// recordingObserver is an Observer which keeps a description of every event.
+type recordingObserver struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(event string) {
+	o.lock.Lock()
+	o.events = append(o.events, event)
+	o.lock.Unlock()
+}
+
+func (o *recordingObserver) OnHit(key string) {
+	o.record("hit " + key)
+}
+
+func (o *recordingObserver) OnMiss(key string) {
+	o.record("miss " + key)
+}
+
+func (o *recordingObserver) OnFetch(key string, duration time.Duration, err error) {
+	o.record("fetch " + key)
+}
+
+func (o *recordingObserver) OnEvict(key string, reason EvictionReason) {
+	o.record("evict " + key + " " + reason.String())
+}
+
+func (o *recordingObserver) Events() []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+// reentrantObserver is an Observer which uses the cache from every callback.
+type reentrantObserver struct {
+	cache CacheWithSettings
+}
+
+func (o *reentrantObserver) OnHit(key string) {
+	o.cache.Stats()
+	o.cache.AddObserver(&recordingObserver{})
+}
+
+func (o *reentrantObserver) OnMiss(key string) {
+	o.cache.Stats()
+}
+
+func (o *reentrantObserver) OnFetch(key string, duration time.Duration, err error) {
+	o.cache.Stats()
+	o.cache.Get(key)
+	o.cache.Set("other", "bar", time.Now().Add(100e9))
+}
+
+func (o *reentrantObserver) OnEvict(key string, reason EvictionReason) {
+	o.cache.Stats()
+}
+
+// jumpingClock is a TestClock whose wall clock may also jump, as after a
+// suspend and resume, without affecting its monotonic clock.  Since is only
+// accurate for times told before the first jump.
+type jumpingClock struct {
+	TestClock
+	jumped time.Duration
+}
+
+func (c *jumpingClock) Jump(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	c.jumped += d
+	c.lock.Unlock()
+}
+
+func (c *jumpingClock) Since(t time.Time) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now.Sub(t) - c.jumped
+}
+
+// expiryOf reports the expiration time of the cached item for a key.
+func expiryOf(cache Cache, key string) time.Time {
+	c := cache.(*readcache)
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	if item, ok := c.Cache[key]; ok {
+		return item.ExpiresAt
+	}
+	return time.Time{}
+}
+
+// recordingHandler is a slog.Handler which keeps every record it handles.
+type recordingHandler struct {
+	lock    sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	h.lock.Lock()
+	h.records = append(h.records, record.Clone())
+	h.lock.Unlock()
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *recordingHandler) Records() []slog.Record {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]slog.Record(nil), h.records...)
+}
+
+func recordAttr(record slog.Record, key string) (value interface{}) {
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == key {
+			value = attr.Value.Any()
+			return false
+		}
+		return true
+	})
+	return
+}
+
 func newGetter(item interface{}, expirationDelta time.Duration) func(string) (interface{}, time.Time, error) {
 	return func(key string) (interface{}, time.Time, error) {
 		return item, time.Now().Add(expirationDelta), nil
@@ -0,0 +1,39 @@
+package readcache
+
+import (
+	"sync"
+	"time"
+)
+
+func (c *readcache) SetStatsReporter(interval time.Duration, report func(CacheStats)) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticks, stopTicker := newTicker(settings(c).Clock, interval)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			// Once stopped, no further report is made, even if a tick is
+			// ready at the same time.
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticks:
+				report(c.Stats())
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stopTicker()
+			close(stop)
+		})
+	}
+}
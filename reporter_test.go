@@ -0,0 +1,57 @@
+package readcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetStatsReporter_ShouldReportIncreasingCountsUntilStopped(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	cache := New(newGetter("foo", time.Hour))
+	cache.SetClock(clock)
+	cache.Get("key")
+	reports := make(chan CacheStats)
+	stop := cache.SetStatsReporter(time.Second, func(stats CacheStats) {
+		reports <- stats
+	})
+
+	var hits []uint64
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		hits = append(hits, (<-reports).Hits)
+		cache.Get("key")
+		cache.Get("key")
+	}
+	for i, expected := range []uint64{0, 2, 4} {
+		if hits[i] != expected {
+			t.Errorf("Expected hits increasing by 2 per report but got %v", hits)
+			break
+		}
+	}
+
+	clock.Advance(time.Second / 2)
+	select {
+	case stats := <-reports:
+		t.Errorf("Unexpected report %+v within an interval", stats)
+	case <-time.After(10 * time.Millisecond):
+	}
+	stop()
+	clock.Advance(time.Second)
+	select {
+	case stats := <-reports:
+		t.Errorf("Unexpected report %+v after stopping", stats)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSetStatsReporter_NonPositiveInterval_ShouldReportNothing(t *testing.T) {
+	cache := NewLazy()
+	stop := cache.SetStatsReporter(0, func(stats CacheStats) {
+		t.Errorf("Unexpected report %+v", stats)
+	})
+	stop()
+	stop = cache.SetStatsReporter(-time.Second, func(stats CacheStats) {
+		t.Errorf("Unexpected report %+v", stats)
+	})
+	stop()
+}
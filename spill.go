@@ -0,0 +1,34 @@
+package readcache
+
+// Write an item purged from the cache to the spill store, if one is
+// configured, so that it can be reloaded on a later miss.  Items which have
+// already expired are not spilled, nor are items for keys which have been
+// stored again since.  The write is made while CacheLock is held for reading,
+// so that a write storing a newer item, which removes any spilled copy once
+// it has stored the item, removes this one too.
+func spillItem(c *readcache, cfg *Config, key string, item *cacheable) {
+	if cfg.SpillStore == nil || !item.ExpiresAt.After(cfg.Clock.Now()) {
+		return
+	}
+	spilled := *item
+	spilled.Value = decodedValue(item)
+	c.CacheLock.RLock()
+	defer c.CacheLock.RUnlock()
+	if _, ok := c.Cache[key]; ok {
+		return
+	}
+	storeToStore(cfg, cfg.SpillStore, key, &spilled)
+}
+
+// Remove items from the spill store, if one is configured.  Errors are
+// logged.
+func dropSpilled(cfg *Config, keys []string) {
+	if cfg.SpillStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := cfg.SpillStore.Delete(key); err != nil && cfg.Logger != nil {
+			cfg.Logger.Warn("readcache: spill store delete failed", "key", key, "error", err)
+		}
+	}
+}
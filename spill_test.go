@@ -0,0 +1,112 @@
+package readcache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet_WithSpillStore_ShouldReloadPurgedItemsWithoutFetching(t *testing.T) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return "value of " + key, time.Now().Add(100e9), nil
+	}
+	spill := newMapL2()
+	cache := New(getter)
+	cache.SetPurgeAt(3)
+	cache.SetPurgeTo(2)
+	cache.SetSpillStore(spill)
+	for i := 0; i < 10; i++ {
+		cache.Get(fmt.Sprintf("key%d", i))
+	}
+	if entries := cache.Stats().Entries; entries > 3 {
+		t.Fatalf("Expected at most 3 entries in memory but got %d", entries)
+	}
+
+	if _, source, _ := cache.GetSourced("key0"); source != SourceSpill {
+		t.Errorf("Expected the purged key0 to be reloaded from the spill store but got %v", source)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if result, err := cache.Get(key); result != "value of "+key || err != nil {
+			t.Errorf("Expected 'value of %s' but got %v, %v", key, result, err)
+		}
+	}
+	if fetchCount != 10 {
+		t.Errorf("Expected each key to be fetched once but got %d fetches", fetchCount)
+	}
+}
+
+func TestDelete_WithSpillStore_ShouldRemoveSpilledCopy(t *testing.T) {
+	spill := newMapL2()
+	cache := New(newGetter("foo", 100e9))
+	cache.SetPurgeAt(2)
+	cache.SetPurgeTo(1)
+	cache.SetSpillStore(spill)
+	cache.Get("key")
+	cache.Get("other")
+	if _, _, ok, _ := spill.Load("key"); !ok {
+		t.Fatal("Expected the purged key to be spilled")
+	}
+
+	cache.Delete("key")
+	if _, _, ok, _ := spill.Load("key"); ok {
+		t.Error("Expected the spilled copy to be deleted")
+	}
+}
+
+// blockingSpill is a spill store whose first Store waits to be let proceed.
+type blockingSpill struct {
+	*mapL2
+	spilling chan struct{}
+	proceed  chan struct{}
+	once     sync.Once
+}
+
+func (s *blockingSpill) Store(key string, value interface{}, expiresAt time.Time) error {
+	s.once.Do(func() {
+		close(s.spilling)
+		<-s.proceed
+	})
+	return s.mapL2.Store(key, value, expiresAt)
+}
+
+func TestSet_WithSpillStore_ConcurrentWithPurge_ShouldNotLeaveStaleSpill(t *testing.T) {
+	spill := &blockingSpill{mapL2: newMapL2(), spilling: make(chan struct{}), proceed: make(chan struct{})}
+	cache := NewLazy()
+	cache.SetPurgeAt(3)
+	cache.SetPurgeTo(1)
+	cache.SetSpillStore(spill)
+	cache.Set("key", "old", time.Now().Add(100e9))
+	cache.Set("other", "other", time.Now().Add(100e9))
+
+	// The third item purges key, which is spilled first.
+	purged := make(chan struct{})
+	go func() {
+		cache.Set("third", "third", time.Now().Add(100e9))
+		close(purged)
+	}()
+	<-spill.spilling
+	set := make(chan struct{})
+	go func() {
+		cache.Set("key", "new", time.Now().Add(100e9))
+		close(set)
+	}()
+	// The Set may be held up until the spill is written.
+	select {
+	case <-set:
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(spill.proceed)
+	<-purged
+	<-set
+
+	if value, _, ok, _ := spill.Load("key"); ok {
+		t.Errorf("Expected no spilled copy of key to outlive the Set but got %v", value)
+	}
+	if result, _, _ := cache.GetNoFetch("key"); result != "new" {
+		t.Errorf("Expected new but got %v", result)
+	}
+}
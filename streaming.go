@@ -0,0 +1,239 @@
+package readcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// The size of the chunks in which a stream is read.
+const streamChunkSize = 32 * 1024
+
+// StreamingCache is a cache whose items are read from streams and held as
+// bytes.
+type StreamingCache interface {
+	CacheWithSettings
+
+	// Retrieve an item as Get does, as the bytes read from its stream.
+	GetBytes(key string) ([]byte, error)
+
+	// Retrieve an item as a reader of its bytes.  If the item is being
+	// fetched, or has to be, the reader yields the bytes as they are read
+	// from the stream, rather than once the whole stream has been read, and
+	// fails with the stream's error if the fetch fails.  The fetch carries on
+	// whether or not the reader is read.
+	GetReader(key string) (io.Reader, error)
+}
+
+// NewStreaming constructs a new cache whose items are fetched as streams.
+// Each stream is read to completion and its bytes are cached, so that later
+// callers share them.  If a stream fails partway, its error is returned and
+// nothing is cached.  A stream which is also an io.Closer is closed once read.
+func NewStreaming(getter func(string) (io.Reader, time.Time, error)) StreamingCache {
+	c := &streamingCache{newReadcache(nil), newStreams()}
+	c.Settings.ContextGetter = func(ctx context.Context, key string) (interface{}, time.Time, error) {
+		stream, expiresAt, err := getter(key)
+		if err != nil {
+			return nil, expiresAt, err
+		}
+		if closer, ok := stream.(io.Closer); ok {
+			defer closer.Close()
+		}
+		value, err := c.Streams.read(ctx, stream)
+		if err != nil {
+			return nil, expiresAt, err
+		}
+		return value, expiresAt, nil
+	}
+	return c
+}
+
+// Type streamingCache implements the StreamingCache interface
+type streamingCache struct {
+	*readcache
+
+	// The streams being read.
+	Streams *streams
+}
+
+func (c *streamingCache) GetBytes(key string) ([]byte, error) {
+	value, err := c.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	bytes, _ := value.([]byte)
+	return bytes, nil
+}
+
+func (c *streamingCache) GetReader(key string) (io.Reader, error) {
+	cfg := settings(c.readcache)
+	cachedValue, readControl, err := getOrReadControl(c.readcache, cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	if readControl == nil {
+		value, _ := cachedValue.Value.([]byte)
+		return bytes.NewReader(value), nil
+	}
+
+	// The buffer is fed by the stream if the fetch reads one, or else given
+	// the outcome of the fetch once it is done.
+	buffer := c.Streams.buffer(readControl.Context)
+	go func() {
+		cachedValue, err := doFetch(c.readcache, cfg, key, readControl, nil, 0)
+		var value []byte
+		if cachedValue != nil {
+			value, _ = cachedValue.Value.([]byte)
+		}
+		buffer.finish(value, err)
+		c.Streams.release(readControl.Context, buffer)
+	}()
+	return &streamReader{Buffer: buffer}, nil
+}
+
+// Type streams holds the buffers of the streams being read, by the context of
+// the fetch reading each.
+type streams struct {
+	Lock    *sync.Mutex
+	Buffers map[context.Context]*streamBuffer
+}
+
+// Create an empty set of streams.
+func newStreams() *streams {
+	return &streams{new(sync.Mutex), make(map[context.Context]*streamBuffer)}
+}
+
+// Get the buffer of the stream read by the fetch with the given context,
+// creating it if the fetch has not yet started reading.
+func (s *streams) buffer(ctx context.Context) *streamBuffer {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	buffer, ok := s.Buffers[ctx]
+	if !ok {
+		buffer = newStreamBuffer()
+		s.Buffers[ctx] = buffer
+	}
+	return buffer
+}
+
+// Forget the buffer of a fetch which is done.
+func (s *streams) release(ctx context.Context, buffer *streamBuffer) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	if s.Buffers[ctx] == buffer {
+		delete(s.Buffers, ctx)
+	}
+}
+
+// Read a stream to completion for the fetch with the given context, feeding
+// its buffer as it is read.  The buffer is left to be finished with the
+// outcome of the fetch.  Only the first read for a fetch feeds the buffer; a
+// hedged read is made on its own.
+func (s *streams) read(ctx context.Context, stream io.Reader) ([]byte, error) {
+	buffer := s.buffer(ctx)
+	if !buffer.claim() {
+		return io.ReadAll(stream)
+	}
+	defer s.release(ctx, buffer)
+	chunk := make([]byte, streamChunkSize)
+	for {
+		n, err := stream.Read(chunk)
+		buffer.write(chunk[:n])
+		if err == io.EOF {
+			return buffer.contents(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Type streamBuffer holds the bytes of a stream read so far, for the readers
+// of the stream.
+type streamBuffer struct {
+	Lock    *sync.Mutex
+	Changed *sync.Cond
+
+	// Whether a read of the stream feeds the buffer.
+	Claimed bool
+
+	// The bytes read so far, and once the stream is done, whether it failed.
+	Data  []byte
+	Done  bool
+	Error error
+}
+
+// Create an empty stream buffer.
+func newStreamBuffer() *streamBuffer {
+	lock := new(sync.Mutex)
+	return &streamBuffer{Lock: lock, Changed: sync.NewCond(lock)}
+}
+
+// Claim the buffer for a read of the stream.  Reports whether the buffer was
+// unclaimed.
+func (b *streamBuffer) claim() bool {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	claimed := b.Claimed || b.Done
+	b.Claimed = true
+	return !claimed
+}
+
+// Append bytes read from the stream, unless the stream is done.
+func (b *streamBuffer) write(p []byte) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	if !b.Done && len(p) > 0 {
+		b.Data = append(b.Data, p...)
+		b.Changed.Broadcast()
+	}
+}
+
+// Get the bytes read so far.
+func (b *streamBuffer) contents() []byte {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return b.Data
+}
+
+// Mark the stream done, with the bytes of the fetched item, which begin with
+// the bytes read so far, or with the fetch's error.  Does nothing if the
+// stream is already done.
+func (b *streamBuffer) finish(value []byte, err error) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	if b.Done {
+		return
+	}
+	if err == nil {
+		b.Data = value
+	}
+	b.Done, b.Error = true, err
+	b.Changed.Broadcast()
+}
+
+// Type streamReader reads a stream buffer as it is filled.
+type streamReader struct {
+	Buffer *streamBuffer
+	Offset int
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	b := r.Buffer
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	for r.Offset == len(b.Data) && !b.Done {
+		b.Changed.Wait()
+	}
+	if r.Offset < len(b.Data) && b.Error == nil {
+		n := copy(p, b.Data[r.Offset:])
+		r.Offset += n
+		return n, nil
+	}
+	if b.Error != nil {
+		return 0, b.Error
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,135 @@
+package readcache
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetBytes_ShouldCacheStreamContents(t *testing.T) {
+	fetchCount := 0
+	cache := NewStreaming(func(key string) (io.Reader, time.Time, error) {
+		fetchCount++
+		return strings.NewReader("contents of " + key), time.Now().Add(100e9), nil
+	})
+	for i := 0; i < 2; i++ {
+		value, err := cache.GetBytes("key")
+		if err != nil || string(value) != "contents of key" {
+			t.Errorf("Expected 'contents of key' but got %q, %v", value, err)
+		}
+	}
+	if fetchCount != 1 {
+		t.Errorf("Should have only fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGetBytes_StreamFailsPartway_ShouldNotCache(t *testing.T) {
+	failure := errors.New("Error message")
+	cache := NewStreaming(func(key string) (io.Reader, time.Time, error) {
+		return io.MultiReader(strings.NewReader("partial"), &failingReader{failure}), time.Now().Add(100e9), nil
+	})
+	value, err := cache.GetBytes("key")
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the stream's error but got %v", err)
+	}
+	if value != nil {
+		t.Errorf("Expected no value but got %q", value)
+	}
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected nothing to be cached but got %s", status)
+	}
+}
+
+func TestGetReader_FirstCaller_ShouldStreamBeforeFetchEnds(t *testing.T) {
+	stream, writer := io.Pipe()
+	fetchCount := 0
+	cache := NewStreaming(func(key string) (io.Reader, time.Time, error) {
+		fetchCount++
+		return stream, time.Now().Add(100e9), nil
+	})
+	reader, err := cache.GetReader("key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	go writer.Write([]byte("first"))
+	chunk := make([]byte, 5)
+	if _, err := io.ReadFull(reader, chunk); err != nil || string(chunk) != "first" {
+		t.Fatalf("Expected 'first' before the fetch ended but got %q, %v", chunk, err)
+	}
+	if inFlight := cache.InFlight(); len(inFlight) != 1 {
+		t.Errorf("Expected the fetch to be underway but got %+v", inFlight)
+	}
+
+	go func() {
+		writer.Write([]byte(" second"))
+		writer.Close()
+	}()
+	if rest, err := io.ReadAll(reader); err != nil || string(rest) != " second" {
+		t.Errorf("Expected ' second' but got %q, %v", rest, err)
+	}
+	if value, err := cache.GetBytes("key"); err != nil || string(value) != "first second" {
+		t.Errorf("Expected the whole stream cached but got %q, %v", value, err)
+	}
+	if fetchCount != 1 {
+		t.Errorf("Should have only fetched once, but got %d", fetchCount)
+	}
+}
+
+func TestGetReader_DuringGetBytes_ShouldStreamSameFetch(t *testing.T) {
+	stream, writer := io.Pipe()
+	fetching := make(chan struct{})
+	cache := NewStreaming(func(key string) (io.Reader, time.Time, error) {
+		close(fetching)
+		return stream, time.Now().Add(100e9), nil
+	})
+	done := make(chan []byte)
+	go func() {
+		value, _ := cache.GetBytes("key")
+		done <- value
+	}()
+	<-fetching
+	reader, err := cache.GetReader("key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+
+	go func() {
+		writer.Write([]byte("contents"))
+		writer.Close()
+	}()
+	if value, err := io.ReadAll(reader); err != nil || string(value) != "contents" {
+		t.Errorf("Expected 'contents' but got %q, %v", value, err)
+	}
+	if value := <-done; string(value) != "contents" {
+		t.Errorf("Expected 'contents' but got %q", value)
+	}
+}
+
+func TestGetReader_StreamFailsPartway_ShouldFailReader(t *testing.T) {
+	failure := errors.New("Error message")
+	cache := NewStreaming(func(key string) (io.Reader, time.Time, error) {
+		return io.MultiReader(strings.NewReader("partial"), &failingReader{failure}), time.Now().Add(100e9), nil
+	})
+	reader, err := cache.GetReader("key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, failure) {
+		t.Errorf("Expected the stream's error but got %v", err)
+	}
+	if status := cache.Status("key"); status != StatusAbsent {
+		t.Errorf("Expected nothing to be cached but got %s", status)
+	}
+}
+
+// failingReader is a reader which always fails.
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
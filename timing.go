@@ -0,0 +1,44 @@
+package readcache
+
+import (
+	"time"
+)
+
+// GetTiming breaks down where a call to GetTimed spent its time.
+type GetTiming struct {
+	// Time spent looking the item up in the cache, which is mostly spent
+	// waiting for locks, and waiting for room if too many fetches are in
+	// flight.
+	Lookup time.Duration
+
+	// Time spent waiting for the item to be fetched, whether by this call or
+	// by another one which this call joined.  Zero if the item was cached.
+	FetchWait time.Duration
+
+	// Time the fetch waited on spent in the item fetchers, including any
+	// fallback.  Zero if the item was cached or loaded from the L2 store.
+	Getter time.Duration
+
+	// Whether the fetch waited on was started by another call.
+	Coalesced bool
+}
+
+func (c *readcache) GetTimed(key string) (interface{}, GetTiming, error) {
+	var timing GetTiming
+	cfg := settings(c)
+	start := time.Now()
+	cachedValue, readControl, err := getOrReadControl(c, cfg, key)
+	timing.Lookup = time.Since(start)
+	if readControl != nil {
+		fetchStart := time.Now()
+		cachedValue, err = doFetch(c, cfg, key, readControl, nil, 0)
+		timing.FetchWait = time.Since(fetchStart)
+		timing.Getter = readControl.Elapsed
+		timing.Coalesced = readControl.Started.Before(start)
+	}
+	if cachedValue != nil {
+		return cachedValue.Value, timing, err
+	}
+
+	return nil, timing, err
+}
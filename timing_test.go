@@ -0,0 +1,47 @@
+package readcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTimed_SlowGetter_ShouldAttributeTimeToGetter(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		time.Sleep(20 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	_, timing, err := cache.GetTimed("key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if timing.Getter < 20*time.Millisecond || timing.FetchWait < timing.Getter || timing.Coalesced {
+		t.Errorf("Expected an uncoalesced fetch of at least 20ms but got %+v", timing)
+	}
+
+	_, timing, _ = cache.GetTimed("key")
+	if timing.FetchWait != 0 || timing.Getter != 0 || timing.Lookup >= 20*time.Millisecond {
+		t.Errorf("Expected a hit to spend no time fetching but got %+v", timing)
+	}
+}
+
+func TestGetTimed_JoiningFetch_ShouldReportCoalescedWait(t *testing.T) {
+	started := make(chan bool)
+	getter := func(key string) (interface{}, time.Time, error) {
+		started <- true
+		time.Sleep(20 * time.Millisecond)
+		return "foo", time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	go cache.Get("key")
+	<-started
+
+	_, timing, err := cache.GetTimed("key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if !timing.Coalesced || timing.FetchWait <= 0 || timing.Getter < 20*time.Millisecond {
+		t.Errorf("Expected a coalesced wait on a 20ms fetch but got %+v", timing)
+	}
+}
@@ -0,0 +1,70 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (c *readcache) Validate() error {
+	var errs []error
+
+	// Warning: possibility of deadlock when dealing with multiple locks.  Make sure
+	//          they are always acquired in the same order.
+	c.ReadControlsLock.RLock()
+	for key, control := range c.ReadControls {
+		if control == nil {
+			errs = append(errs, fmt.Errorf("readcache: nil read control for %q", key))
+		}
+	}
+	c.CacheLock.RLock()
+	inHistory := make(map[string]bool, c.AdditionCount)
+	for element := c.Additions.Front(); element != nil; element = element.Next() {
+		inHistory[element.Value.(string)] = true
+	}
+	if c.Additions.Len() != c.AdditionCount {
+		errs = append(errs, fmt.Errorf("readcache: history holds %d keys but is counted as %d", c.Additions.Len(), c.AdditionCount))
+	}
+	for key, item := range c.Cache {
+		if item == nil {
+			errs = append(errs, fmt.Errorf("readcache: nil item for %q", key))
+			continue
+		}
+		if item.Version == 0 || item.Version > c.LastVersion {
+			errs = append(errs, fmt.Errorf("readcache: item for %q has version %d outside 1 to %d", key, item.Version, c.LastVersion))
+		}
+		if !item.FetchedAt.IsZero() && !item.FetchedAt.Add(item.TTL).Equal(item.ExpiresAt) {
+			errs = append(errs, fmt.Errorf("readcache: item for %q expires at %v, but its TTL ends at %v", key, item.ExpiresAt, item.FetchedAt.Add(item.TTL)))
+		}
+		if generation := c.Generation.Load(); item.Generation > generation {
+			errs = append(errs, fmt.Errorf("readcache: item for %q is from generation %d, after the current %d", key, item.Generation, generation))
+		}
+		if !inHistory[key] {
+			errs = append(errs, fmt.Errorf("readcache: item for %q is missing from the history", key))
+		}
+	}
+	c.CacheLock.RUnlock()
+	c.ReadControlsLock.RUnlock()
+
+	backoffs := c.ErrorBackoffs
+	maxEntries := settings(c).MaxNegativeEntries
+	backoffs.Lock.Lock()
+	if maxEntries <= 0 {
+		maxEntries = backoffs.MaxEntries
+	}
+	if len(backoffs.Entries) != backoffs.Order.Len() {
+		errs = append(errs, fmt.Errorf("readcache: %d error backoffs are indexed but %d are ordered", len(backoffs.Entries), backoffs.Order.Len()))
+	}
+	if len(backoffs.Entries) > maxEntries {
+		errs = append(errs, fmt.Errorf("readcache: %d error backoffs exceed the maximum of %d", len(backoffs.Entries), maxEntries))
+	}
+	backoffs.Lock.Unlock()
+
+	slots := c.FetchSlots
+	slots.Lock.Lock()
+	if slots.Active < 0 || len(slots.Waiting) > 0 && slots.Active == 0 {
+		errs = append(errs, fmt.Errorf("readcache: %d fetch slots are taken while %d fetches wait", slots.Active, len(slots.Waiting)))
+	}
+	slots.Lock.Unlock()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidate_AfterNormalUse_ShouldPass(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "bad" {
+			return nil, time.Now(), errors.New("Error message")
+		}
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	cache.SetPurgeAt(8)
+	cache.SetPurgeTo(4)
+	cache.SetErrorBackoff(100e9)
+	cache.SetMonotonicExpiry(true)
+	cache.SetSlidingExpiration(time.Minute)
+	runConcurrencyTest(cache, 4, 100)
+	cache.Get("bad")
+	cache.Set("set", "value", time.Now().Add(100e9))
+	cache.Delete("1")
+
+	if err := cache.Validate(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestValidate_WithMaxNegativeEntriesAboveDefault_ShouldPass(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), errors.New("Error message")
+	}
+	cache := New(getter)
+	cache.SetErrorBackoff(100e9)
+	cache.SetMaxNegativeEntries(1500)
+	for i := 0; i < 1500; i++ {
+		cache.Get(fmt.Sprintf("%d", i))
+	}
+
+	if err := cache.Validate(); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
+
+func TestValidate_CorruptedState_ShouldReportEachProblem(t *testing.T) {
+	cache := New(newGetter("foo", 100e9))
+	cache.Get("key")
+	cache.Get("other")
+
+	c := cache.(*readcache)
+	c.CacheLock.Lock()
+	c.Cache["nil"] = nil
+	c.Cache["unversioned"] = &cacheable{Value: "foo", ExpiresAt: time.Now().Add(100e9)}
+	c.AdditionCount++
+	c.CacheLock.Unlock()
+
+	err := cache.Validate()
+	if err == nil {
+		t.Fatal("Expected the corruption to be reported")
+	}
+	for _, expected := range []string{
+		`readcache: nil item for "nil"`,
+		`readcache: item for "unversioned" has version 0 outside 1 to 2`,
+		`readcache: item for "unversioned" is missing from the history`,
+		`readcache: history holds 2 keys but is counted as 3`,
+	} {
+		found := false
+		for _, reported := range err.(interface{ Unwrap() []error }).Unwrap() {
+			if reported.Error() == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %q to be reported, but got %v", expected, err)
+		}
+	}
+}
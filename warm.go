@@ -0,0 +1,114 @@
+package readcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+func (c *readcache) Warm(keys []string, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	cfg := settings(c)
+
+	var errs []error
+	var errsLock sync.Mutex
+	var wait sync.WaitGroup
+	pending := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for key := range pending {
+				if _, err := get(c, cfg, key); err != nil {
+					errsLock.Lock()
+					errs = append(errs, err)
+					errsLock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, key := range keys {
+		pending <- key
+	}
+	close(pending)
+	wait.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (c *readcache) WarmFromChannel(keys <-chan string, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	c.WarmingLock.Lock()
+	stop := c.WarmingStop
+	c.WarmingLock.Unlock()
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for {
+				// Once stopped, no further key is received, even if one is
+				// ready at the same time.
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				select {
+				case <-stop:
+					return
+				case key, ok := <-keys:
+					if !ok {
+						return
+					}
+					get(c, settings(c), key)
+				}
+			}
+		}()
+	}
+}
+
+func (c *readcache) StopWarming() {
+	c.WarmingLock.Lock()
+	close(c.WarmingStop)
+	c.WarmingStop = make(chan struct{})
+	c.WarmingLock.Unlock()
+}
+
+func (c *readcache) RefreshExpiring(within time.Duration, concurrency int) int {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	cfg := settings(c)
+	now := cfg.Clock.Now()
+
+	var keys []string
+	c.CacheLock.RLock()
+	for key, item := range c.Cache {
+		if !expiryTime(c, cfg, item, now).After(now.Add(within)) {
+			keys = append(keys, key)
+		}
+	}
+	c.CacheLock.RUnlock()
+
+	pending := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for key := range pending {
+				if control := refresh(c, cfg, key); control != nil {
+					<-control.Done
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, key := range keys {
+			pending <- key
+		}
+		close(pending)
+	}()
+
+	return len(keys)
+}
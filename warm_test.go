@@ -0,0 +1,165 @@
+package readcache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWarm_WithManyKeys_ShouldFetchEachKeyOnce(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	fetchCount := make(map[string]int)
+	inFlight, maxInFlight := 0, 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount[key]++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		fetchLock.Unlock()
+		time.Sleep(time.Millisecond)
+		fetchLock.Lock()
+		inFlight--
+		fetchLock.Unlock()
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%d", i)
+	}
+	if err := cache.Warm(keys, 8); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	if stats := cache.Stats(); stats.Entries != 100 {
+		t.Errorf("Expected 100 entries but got %d", stats.Entries)
+	}
+	for _, key := range keys {
+		if fetchCount[key] != 1 {
+			t.Errorf("Expected %s to be fetched once but got %d", key, fetchCount[key])
+		}
+	}
+	if maxInFlight > 8 {
+		t.Errorf("Expected at most 8 concurrent fetches but got %d", maxInFlight)
+	}
+}
+
+func TestWarm_ErrorInGetter_ShouldJoinErrors(t *testing.T) {
+	failure := errors.New("Error message")
+	getter := func(key string) (interface{}, time.Time, error) {
+		if key == "bad" {
+			return nil, time.Now(), failure
+		}
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	err := cache.Warm([]string{"good", "bad"}, 2)
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the getter's error but got %v", err)
+	}
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Errorf("Expected the good key to be cached, but got %d entries", stats.Entries)
+	}
+}
+
+func TestRefreshExpiring_WithStaggeredExpiries_ShouldRefreshOnlyNearExpiry(t *testing.T) {
+	clock := NewTestClock(time.Now())
+	fetchLock := new(sync.Mutex)
+	fetchCount := make(map[string]int)
+	ttls := map[string]time.Duration{"soon": time.Second, "sooner": 500 * time.Millisecond, "later": time.Hour}
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount[key]++
+		fetchLock.Unlock()
+		return key, clock.Now().Add(ttls[key]), nil
+	}
+	refreshed := make(chan string, 10)
+	cache := New(getter)
+	cache.SetClock(clock)
+	cache.SetOnRefresh(func(key string, newValue interface{}, err error) {
+		refreshed <- key
+	})
+	for key := range ttls {
+		cache.Get(key)
+	}
+
+	if scheduled := cache.RefreshExpiring(time.Minute, 2); scheduled != 2 {
+		t.Errorf("Expected 2 refreshes to be scheduled but got %d", scheduled)
+	}
+	got := map[string]bool{<-refreshed: true, <-refreshed: true}
+	if !got["soon"] || !got["sooner"] {
+		t.Errorf("Expected soon and sooner to be refreshed but got %v", got)
+	}
+	fetchLock.Lock()
+	defer fetchLock.Unlock()
+	if fetchCount["soon"] != 2 || fetchCount["sooner"] != 2 || fetchCount["later"] != 1 {
+		t.Errorf("Expected only the near-expiry keys to be fetched again but got %v", fetchCount)
+	}
+}
+
+func TestWarmFromChannel_WithLiveGets_ShouldFetchEachKeyOnce(t *testing.T) {
+	fetchLock := new(sync.Mutex)
+	fetchCount := make(map[string]int)
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchLock.Lock()
+		fetchCount[key]++
+		fetchLock.Unlock()
+		time.Sleep(time.Millisecond)
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	keys := make(chan string)
+	cache.WarmFromChannel(keys, 4)
+	var wait sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("%d", i)
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			cache.Get(key)
+		}()
+		keys <- key
+	}
+	close(keys)
+	wait.Wait()
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("%d", i)
+		for cache.Status(key) != StatusFresh {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	fetchLock.Lock()
+	defer fetchLock.Unlock()
+	for key, count := range fetchCount {
+		if count != 1 {
+			t.Errorf("Expected %s to be fetched once but got %d", key, count)
+		}
+	}
+}
+
+func TestStopWarming_ShouldStopReceivingKeys(t *testing.T) {
+	getter := func(key string) (interface{}, time.Time, error) {
+		return key, time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+	keys := make(chan string)
+	cache.WarmFromChannel(keys, 2)
+	keys <- "before"
+	cache.StopWarming()
+
+	select {
+	case keys <- "after":
+		t.Errorf("Expected no key to be received after StopWarming")
+	case <-time.After(10 * time.Millisecond):
+	}
+	for cache.Status("before") != StatusFresh {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+package readcache
+
+import (
+	"sync"
+)
+
+// Type watchers tracks the channels to which the values fetched for each key
+// are sent; see Watch.
+type watchers struct {
+	// Locks the channels for reads or writes
+	Lock *sync.Mutex
+
+	// The channels, by key
+	Updates map[string]map[chan interface{}]bool
+}
+
+func newWatchers() *watchers {
+	return &watchers{new(sync.Mutex), make(map[string]map[chan interface{}]bool)}
+}
+
+func (c *readcache) Watch(key string) (interface{}, <-chan interface{}, func(), error) {
+	cachedValue, err := get(c, settings(c), key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var value interface{}
+	if cachedValue != nil {
+		value = cachedValue.Value
+	}
+	updates, cancel := c.Watchers.add(key)
+	return value, updates, cancel, nil
+}
+
+// Start watching a key, returning the channel the key's values are sent to
+// and the function which stops the watch and closes the channel.
+func (w *watchers) add(key string) (chan interface{}, func()) {
+	updates := make(chan interface{}, 1)
+	w.Lock.Lock()
+	if w.Updates[key] == nil {
+		w.Updates[key] = make(map[chan interface{}]bool)
+	}
+	w.Updates[key][updates] = true
+	w.Lock.Unlock()
+
+	var once sync.Once
+	return updates, func() {
+		once.Do(func() {
+			w.Lock.Lock()
+			delete(w.Updates[key], updates)
+			if len(w.Updates[key]) == 0 {
+				delete(w.Updates, key)
+			}
+			close(updates)
+			w.Lock.Unlock()
+		})
+	}
+}
+
+// Send a value fetched for a key to each of the key's watchers.  A watcher
+// which has not yet received its previous value has it replaced, so that a
+// slow watcher never holds up a fetch.
+func (w *watchers) send(key string, value interface{}) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	for updates := range w.Updates[key] {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- value
+	}
+}
@@ -0,0 +1,51 @@
+package readcache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch_RefreshedKey_ShouldSendUpdate(t *testing.T) {
+	var fetchCount atomic.Int32
+	getter := func(key string) (interface{}, time.Time, error) {
+		return int(fetchCount.Add(1)), time.Now().Add(100e9), nil
+	}
+	cache := New(getter)
+
+	value, updates, cancel, err := cache.Watch("key")
+	if value != 1 || err != nil {
+		t.Fatalf("Expected 1 but got %v, %v", value, err)
+	}
+	cache.RefreshExpiring(time.Hour, 1)
+	select {
+	case update := <-updates:
+		if update != 2 {
+			t.Errorf("Expected the refreshed value 2 but got %v", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an update after the refresh")
+	}
+
+	cancel()
+	if _, ok := <-updates; ok {
+		t.Errorf("Expected the channel to be closed once cancelled")
+	}
+	if watched := len(cache.(*readcache).Watchers.Updates); watched != 0 {
+		t.Errorf("Expected no keys to be watched but got %d", watched)
+	}
+	cancel()
+}
+
+func TestWatch_ErrorInGetter_ShouldNotWatch(t *testing.T) {
+	failure := errors.New("Error message")
+	getter := func(key string) (interface{}, time.Time, error) {
+		return nil, time.Now(), failure
+	}
+	cache := New(getter)
+
+	if _, updates, _, err := cache.Watch("key"); updates != nil || !errors.Is(err, failure) {
+		t.Errorf("Expected the getter's error and no channel but got %v", err)
+	}
+}
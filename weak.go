@@ -0,0 +1,65 @@
+package readcache
+
+import (
+	"reflect"
+	"unsafe"
+	"weak"
+)
+
+// Hold the value of an item to be stored in the cache through a weak
+// pointer, if weak values are configured and the value is a pointer.  Items
+// are never modified once cached, so a weakened copy is returned, leaving the
+// given item to be handed to the caller.
+func weakenItem(cfg *Config, item *cacheable) *cacheable {
+	if !cfg.WeakValues || item.Value == nil {
+		return item
+	}
+	value := reflect.ValueOf(item.Value)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Type().Elem().Size() == 0 {
+		return item
+	}
+	weakened := *item
+	weakened.Value = nil
+	weakened.Weak = weak.Make((*byte)(value.UnsafePointer()))
+	weakened.WeakType = value.Type()
+	return &weakened
+}
+
+// Determine whether the value of an item found in the cache has been
+// reclaimed by the garbage collector.
+func reclaimed(item *cacheable) bool {
+	return item.WeakType != nil && item.Weak.Value() == nil
+}
+
+// Restore the value of an item found in the cache, if it is held through a
+// weak pointer.  The value is nil if it has been reclaimed.
+func strengthenItem(item *cacheable) *cacheable {
+	if item.WeakType == nil {
+		return item
+	}
+	strong := *item
+	if pointer := item.Weak.Value(); pointer != nil {
+		strong.Value = reflect.NewAt(item.WeakType.Elem(), unsafe.Pointer(pointer)).Interface()
+	}
+	strong.Weak, strong.WeakType = weak.Pointer[byte]{}, nil
+	return &strong
+}
+
+// Remove an item found in the cache if its value has been reclaimed, unless
+// another goroutine has replaced it in the meantime.  Reports whether the
+// value was reclaimed.
+func discardReclaimed(c *readcache, cfg *Config, key string, cachedValue *cacheable) bool {
+	if !reclaimed(cachedValue) {
+		return false
+	}
+	c.CacheLock.Lock()
+	removed := c.Cache[key] == cachedValue
+	if removed {
+		deleteItem(c, key)
+	}
+	c.CacheLock.Unlock()
+	if removed {
+		notifyEvictions(c, cfg, []evictedItem{{key, cachedValue, EvictionReclaimed}})
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package readcache
+
+import (
+	"runtime"
+	"testing"
+	"time"
+	"weak"
+)
+
+// Type weakValue is large enough not to be batched with other allocations,
+// so that it is reclaimed as soon as it is unreachable.
+type weakValue struct {
+	Fetch   int
+	Padding [1024]byte
+}
+
+func newWeakCache() (CacheWithSettings, *[]EvictionReason) {
+	fetchCount := 0
+	getter := func(key string) (interface{}, time.Time, error) {
+		fetchCount++
+		return &weakValue{Fetch: fetchCount}, time.Now().Add(100e9), nil
+	}
+	var reasons []EvictionReason
+	cache := New(getter)
+	cache.SetWeakValues(true)
+	cache.SetOnEvict(func(key string, value interface{}, reason EvictionReason) {
+		reasons = append(reasons, reason)
+	})
+	return cache, &reasons
+}
+
+func TestGet_WithWeakValues_ValueReclaimed_ShouldRefetch(t *testing.T) {
+	cache, reasons := newWeakCache()
+	result, _ := cache.Get("key")
+	probe := weak.Make(result.(*weakValue))
+	result = nil
+	for i := 0; i < 10 && probe.Value() != nil; i++ {
+		runtime.GC()
+	}
+	if probe.Value() != nil {
+		t.Fatal("Expected the value to be reclaimed")
+	}
+
+	result, _ = cache.Get("key")
+	if fetch := result.(*weakValue).Fetch; fetch != 2 {
+		t.Errorf("Expected the refetched value 2 but got %v", fetch)
+	}
+	if len(*reasons) != 1 || (*reasons)[0] != EvictionReclaimed {
+		t.Errorf("Expected a single reclaimed eviction but got %v", *reasons)
+	}
+}
+
+func TestGet_WithWeakValues_ValueReferenced_ShouldServeCachedValue(t *testing.T) {
+	cache, reasons := newWeakCache()
+	first, _ := cache.Get("key")
+	runtime.GC()
+	runtime.GC()
+
+	second, _ := cache.Get("key")
+	if second != first {
+		t.Errorf("Expected the cached value %p but got %p", first, second)
+	}
+	runtime.KeepAlive(first)
+	if len(*reasons) != 0 {
+		t.Errorf("Expected no evictions but got %v", *reasons)
+	}
+}
@@ -0,0 +1,94 @@
+package readcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Type writeBehind queues writes to the L2 store, so that they are made by a
+// background worker rather than by the goroutine which stored the item.  The
+// worker is started when writes are queued and stops once the queue is empty.
+type writeBehind struct {
+	// Locks the queue for reads or writes
+	Lock *sync.Mutex
+
+	// The queued writes, oldest first
+	Pending *list.List
+
+	// Signalled whenever a write is taken from the queue.  Uses Lock.
+	Space *sync.Cond
+
+	// Whether the worker is running
+	Running bool
+
+	// The number of writes dropped because the queue was full
+	Dropped uint64
+}
+
+// Type l2Write is a queued write to the L2 store.  Either the item for a key
+// is stored, or if there is no item, the keys are deleted.
+type l2Write struct {
+	Settings *Config
+	Keys     []string
+	Item     *cacheable
+}
+
+func newWriteBehind() *writeBehind {
+	lock := new(sync.Mutex)
+	return &writeBehind{Lock: lock, Pending: list.New(), Space: sync.NewCond(lock)}
+}
+
+// Queue a write, dropping it or waiting for space if the queue is full, as
+// configured by the write's settings.  A deletion is never dropped, since the
+// L2 store would go on serving the deleted items; it always waits.
+func (w *writeBehind) enqueue(write *l2Write) {
+	cfg := write.Settings
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+
+	for w.Pending.Len() >= cfg.WriteBehindBuffer {
+		if !cfg.BlockWriteBehind && write.Item != nil {
+			w.Dropped++
+			if cfg.Logger != nil {
+				cfg.Logger.Warn("readcache: L2 write dropped", "keys", write.Keys)
+			}
+			return
+		}
+		w.Space.Wait()
+	}
+	w.Pending.PushBack(write)
+	if !w.Running {
+		w.Running = true
+		go w.run()
+	}
+}
+
+// Make the queued writes in order, until the queue is empty.
+func (w *writeBehind) run() {
+	for {
+		w.Lock.Lock()
+		next := w.Pending.Front()
+		if next == nil {
+			w.Running = false
+			w.Lock.Unlock()
+			return
+		}
+		w.Pending.Remove(next)
+		w.Space.Broadcast()
+		w.Lock.Unlock()
+
+		write := next.Value.(*l2Write)
+		if write.Item != nil {
+			storeToL2Now(write.Settings, write.Keys[0], write.Item)
+		} else {
+			deleteFromL2Now(write.Settings, write.Keys)
+		}
+	}
+}
+
+// Report the number of writes dropped because the queue was full.
+func (w *writeBehind) dropped() uint64 {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	return w.Dropped
+}